@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/harisbeha/media-transcoder/internal/intake"
 	"github.com/harisbeha/media-transcoder/internal/subscriber"
 
 	config "github.com/harisbeha/media-transcoder/internal/config"
@@ -43,6 +44,13 @@ func startSubscribers() {
 		Namespace:   jobNamespace,
 		JobName:     jobName,
 		Concurrency: config.Get().WorkerConcurrency,
+		Intake: intake.Config{
+			Type:               config.Get().IntakeSource,
+			PubsubTopic:        config.Get().PubsubTopic,
+			PubsubSubscription: config.Get().PubsubSubscription,
+			RedisStream:        config.Get().IntakeRedisStream,
+			RedisGroup:         config.Get().IntakeRedisGroup,
+		},
 	}
 
 	// Create Workers.
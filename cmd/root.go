@@ -13,16 +13,17 @@ var cfgFile string
 var rootCmd = &cobra.Command{
 	Use:   "c24_media",
 	Short: "Onex Labs Media Processing Suite",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Load config once flags are parsed so --config is honoured.
+		config.LoadConfig(cfgFile)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		// Do Stuff Here
 	},
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "default", "Config YAML")
-
-	config.LoadConfig(cfgFile)
-	fmt.Println(config.Get())
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", config.DefaultConfigName, "Config YAML")
 }
 
 // Execute starts cmd.
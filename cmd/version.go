@@ -12,6 +12,8 @@ func init() {
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: " Print the version.",
+	// Printing the version needs no config.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Version 0.1.0")
 	},
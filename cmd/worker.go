@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/harisbeha/media-transcoder/internal/service"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(workerCmd)
+}
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Start the all-in-one worker running the whole pipeline.",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Starting worker...")
+		startPipelineWorker()
+	},
+}
+
+func startPipelineWorker() {
+
+	// Worker config.
+	workerCfg := &service.WorkerConfig{
+		Host:        config.Get().RedisHost,
+		Port:        config.Get().RedisPort,
+		Namespace:   config.Get().TranscodeWorkerNamespace,
+		JobName:     config.Get().TranscodeWorkerJobName,
+		Concurrency: config.Get().WorkerConcurrency,
+	}
+
+	// Create Workers.
+	service.NewPipelineWorker(*workerCfg)
+}
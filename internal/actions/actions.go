@@ -7,16 +7,15 @@ import (
 	config "github.com/harisbeha/media-transcoder/internal/config"
 	data "github.com/harisbeha/media-transcoder/internal/data"
 	"github.com/harisbeha/media-transcoder/internal/helpers"
-	"github.com/harisbeha/media-transcoder/internal/kube"
 	models "github.com/harisbeha/media-transcoder/internal/models"
 	ffprobe "github.com/harisbeha/media-transcoder/internal/probe"
+	"github.com/harisbeha/media-transcoder/internal/results"
 	"github.com/harisbeha/media-transcoder/internal/storage"
 	transcode "github.com/harisbeha/media-transcoder/internal/transcode"
-	batchv1 "k8s.io/api/batch/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"github.com/harisbeha/media-transcoder/internal/webhook"
 	"math"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -28,11 +27,17 @@ var progressCh chan struct{}
 
 const progressInterval = time.Second * 2
 
+// progressMilestone is the encode progress step, in percent, between
+// progress webhooks.
+const progressMilestone = 25.0
+
 func download(job models.Job) error {
 	log.Info("running download task")
 
 	// Update status.
-	data.UpdateJobStatus(job.GUID, models.JobDownloading)
+	if err := data.UpdateJobStatus(job.GUID, models.JobDownloading); err != nil {
+		return err
+	}
 
 	// Get job data.
 	j, _ := data.GetJobByGUID(job.GUID)
@@ -55,9 +60,13 @@ func download(job models.Job) error {
 		storagePath = fmt.Sprintf("%s/src/%s", config.Get().WorkDirectory, job.C24JobID)
 	}
 	err := storage.DownloadFile(job.Source, storagePath)
+	if err != nil {
+		return err
+	}
 	err = helpers.FileExists(storagePath)
 	if err != nil {
 		log.Info(err.Error())
+		return Permanent(err)
 	}
 
 	// Set progress to 100.
@@ -65,17 +74,49 @@ func download(job models.Job) error {
 	return err
 }
 
+// fetchSource downloads the source of a transcode job to the work directory.
+func fetchSource(job models.Job) error {
+	log.Info("running fetch task")
+
+	// Update status.
+	if err := data.UpdateJobStatus(job.GUID, models.JobDownloading); err != nil {
+		return err
+	}
+
+	sourceMediaPath := getSourceMediaPath(job.C24JobID)
+	if err := storage.DownloadFile(job.Source, sourceMediaPath); err != nil {
+		return err
+	}
+	if err := helpers.FileExists(sourceMediaPath); err != nil {
+		return Permanent(err)
+	}
+	return data.UpdateJobStatus(job.GUID, models.JobDownloaded)
+}
+
 func probe(job models.Job) (*ffprobe.FFProbeResponse, error) {
 	log.Info("running probe task")
 
 	// Update status.
-	data.UpdateJobStatus(job.GUID, models.JobProbing)
+	if err := data.UpdateJobStatus(job.GUID, models.JobProbing); err != nil {
+		return nil, err
+	}
 
 	// Run FFProbe.
 	f := ffprobe.FFProbe{}
 
 	sourceMediaPath := getSourceMediaPath(job.C24JobID)
-	probeData := f.Run(sourceMediaPath)
+	if _, err := os.Stat(sourceMediaPath); err != nil {
+		log.Error(err)
+		return nil, ErrSourceMissing
+	}
+	// The source is there, so probing it again won't help.
+	probeData, err := f.Probe(sourceMediaPath)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("probing source: %v", err))
+	}
+	if len(probeData.Streams) == 0 {
+		return nil, Permanent(fmt.Errorf("probing source: no streams found"))
+	}
 
 	// Add probe data to DB.
 	b, err := json.Marshal(probeData)
@@ -88,41 +129,91 @@ func probe(job models.Job) (*ffprobe.FFProbeResponse, error) {
 	return probeData, nil
 }
 
+// storedProbeData returns the probe data recorded by an earlier run of a
+// job, or nil when there is none.
+func storedProbeData(job models.Job) *ffprobe.FFProbeResponse {
+	j, err := data.GetJobByGUID(job.GUID)
+	if err != nil || !j.Data.Valid {
+		return nil
+	}
+	probeData := &ffprobe.FFProbeResponse{}
+	if err := json.Unmarshal([]byte(j.Data.String), probeData); err != nil || len(probeData.Streams) == 0 {
+		return nil
+	}
+	return probeData
+}
+
 func encode(job models.Job, probeData *ffprobe.FFProbeResponse) error {
 	log.Info("running encode task")
 
 	// Update status.
-	data.UpdateJobStatus(job.GUID, models.JobEncoding)
-
-	p, err := config.GetFFmpegProfile(job.Profile)
-	if err != nil {
+	if err := data.UpdateJobStatus(job.GUID, models.JobEncoding); err != nil {
 		return err
 	}
-	//dest := path.Dir(job.LocalSource) + "/dst/" + p.Output
 
 	// Get job data.
 	j, _ := data.GetJobByGUID(job.GUID)
 	encodeID := j.EncodeDataID
-
-	// Run FFmpeg.
-	f := &transcode.FFmpeg{}
-	go trackEncodeProgress(encodeID, probeData, f)
 	sourceMediaPath := getSourceMediaPath(j.C24JobID)
 	log.Info("source media path", sourceMediaPath)
-	dest := "/mpc/dst/" + j.C24JobID + p.Output
-	f.Run(sourceMediaPath, dest, p.Options)
-	close(progressCh)
+
+	// Encode every output from the same source.
+	for _, o := range getJobOutputs(j) {
+		p, err := config.GetFFmpegProfile(o.Profile)
+		if err != nil {
+			setOutputStatus(o, models.OutputError)
+			return Permanent(err)
+		}
+		setOutputStatus(o, models.OutputEncoding)
+
+		// Run FFmpeg.
+		f := &transcode.FFmpeg{}
+		done := make(chan struct{})
+		go trackEncodeProgress(j.GUID, encodeID, probeData, f, done)
+		dest := getOutputMediaPath(j.C24JobID, o.Profile, p.Output)
+
+		// Don't let a partial output of an earlier attempt pass for this one.
+		if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+			close(done)
+			setOutputStatus(o, models.OutputError)
+			return err
+		}
+		err = f.Run(sourceMediaPath, dest, p.Options)
+		close(done)
+		if f.Stopped() {
+			setOutputStatus(o, models.OutputError)
+			if err := leaseStopped(j.GUID); err != nil {
+				return err
+			}
+			return ErrCancelled
+		}
+		if _, ok := err.(*exec.ExitError); ok {
+			setOutputStatus(o, models.OutputError)
+			return Permanent(fmt.Errorf("encoding %s: %v", o.Profile, err))
+		}
+		if err != nil {
+			setOutputStatus(o, models.OutputError)
+			return err
+		}
+
+		if err := helpers.FileExists(dest); err != nil {
+			setOutputStatus(o, models.OutputError)
+			return Permanent(err)
+		}
+	}
 
 	// Set encode progress to 100.
 	data.UpdateEncodeProgressByID(encodeID, 100)
-	return err
+	return nil
 }
 
 func upload(job models.Job) error {
 	log.Info("running upload task")
 
 	// Update status.
-	data.UpdateJobStatus(job.GUID, models.JobUploading)
+	if err := data.UpdateJobStatus(job.GUID, models.JobUploading); err != nil {
+		return err
+	}
 
 	// Get job data.
 	j, _ := data.GetJobByGUID(job.GUID)
@@ -139,20 +230,80 @@ func upload(job models.Job) error {
 	//
 	//// Close channel to stop progress updates.
 	//close(progressCh)
-	p, err := config.GetFFmpegProfile(job.Profile)
-	if err != nil {
-		return err
+	outputs := getJobOutputs(j)
+	for _, o := range outputs {
+		p, err := config.GetFFmpegProfile(o.Profile)
+		if err != nil {
+			setOutputStatus(o, models.OutputError)
+			return Permanent(err)
+		}
+		setOutputStatus(o, models.OutputUploading)
+
+		localPath := getOutputMediaPath(j.C24JobID, o.Profile, p.Output)
+		if err := helpers.FileExists(localPath); err != nil {
+			setOutputStatus(o, models.OutputError)
+			return Permanent(err)
+		}
+		o.URL = getOutputURL(*j, o, p.Output, len(outputs))
+		log.Info(o.URL)
+		if err := storage.UploadFile(localPath, o.URL); err != nil {
+			setOutputStatus(o, models.OutputError)
+			return err
+		}
+
+		// Record the uploaded output.
+		describeOutput(&o, localPath)
+		o.Status = models.OutputCompleted
+		if o.ID != 0 {
+			data.UpdateJobOutput(o)
+		}
 	}
-	localPath := "/mpc/dst/" + j.C24JobID + p.Output
-	storagePath := localPath
-	storageUrl := prefixPathWithService("gs", "dev-experiments", storagePath)
-	log.Info(storageUrl)
-	err = helpers.FileExists(localPath)
-	err = storage.UploadFile(localPath, j.Destination)
 
 	// Set progress to 100.
 	data.UpdateEncodeProgressByID(encodeID, 100)
-	return err
+	return nil
+}
+
+// getJobOutputs returns the outputs of a job. Jobs created before outputs
+// were recorded fall back to their single profile.
+func getJobOutputs(job *models.Job) []models.JobOutput {
+	if len(job.Outputs) > 0 {
+		return job.Outputs
+	}
+	return []models.JobOutput{{
+		JobID:   job.ID,
+		Profile: job.Profile,
+		Status:  models.OutputPending,
+	}}
+}
+
+func setOutputStatus(o models.JobOutput, status string) {
+	if o.ID == 0 {
+		return
+	}
+	data.UpdateJobOutputStatus(o.ID, status)
+}
+
+// describeOutput fills in the size, checksum, duration and bitrate of an
+// encoded output file.
+func describeOutput(o *models.JobOutput, localPath string) {
+	if info, err := os.Stat(localPath); err == nil {
+		o.Size = info.Size()
+	}
+	if sum, err := helpers.FileChecksum(localPath); err == nil {
+		o.Checksum = sum
+	} else {
+		log.Error(err)
+	}
+
+	f := ffprobe.FFProbe{}
+	probeData, err := f.Probe(localPath)
+	if err != nil {
+		log.Errorf("probing output %s: %v", localPath, err)
+		return
+	}
+	o.Duration, _ = strconv.ParseFloat(probeData.Format.Duration, 64)
+	o.Bitrate, _ = strconv.ParseInt(probeData.Format.BitRate, 10, 64)
 }
 
 func cleanup(job models.Job) error {
@@ -190,8 +341,9 @@ func sendAlert(job models.Job) error {
 			"*Job ID*: %s:\n"+
 			"*Profile*: %s\n"+
 			"*Source*: %s\n"+
-			"*Destination*: %s\n\n",
-		job.GUID, job.C24JobID, job.Profile, job.Source, job.Destination)
+			"*Destination*: %s\n"+
+			"*Metadata*: %s\n\n",
+		job.GUID, job.C24JobID, job.Profile, job.Source, job.Destination, formatMetadata(job.Meta))
 	err := alert.SendSlackMessage(config.Get().SlackWebhook, message)
 	if err != nil {
 		return err
@@ -207,8 +359,9 @@ func notifyCompletion(job models.Job) error {
 			"*Job ID*: %s:\n"+
 			"*Profile*: %s\n"+
 			"*Source*: %s\n"+
-			"*Destination*: %s\n\n",
-		job.GUID, job.Profile, job.Source, job.Destination)
+			"*Destination*: %s\n"+
+			"*Metadata*: %s\n\n",
+		job.GUID, job.Profile, job.Source, job.Destination, formatMetadata(job.Meta))
 	err := alert.SendSlackMessage(config.Get().SlackWebhook, message)
 	if err != nil {
 		return err
@@ -216,69 +369,192 @@ func notifyCompletion(job models.Job) error {
 	return nil
 }
 
-func RunDownloadJob(job models.Job) {
+// FailJob marks a job as errored and notifies its callback and the
+// requesting system.
+func FailJob(job models.Job, err error) {
+	log.Error(err)
+
+	// The job was moved on elsewhere, e.g. cancelled or reaped; leave it as
+	// it is.
+	if err == data.ErrInvalidTransition || err == ErrCancelled || err == ErrLeaseLost {
+		return
+	}
+	if err == ErrInterrupted {
+		handBack(job)
+		return
+	}
+	if e, ok := err.(*ExhaustedError); ok {
+		deadLetter(job, e)
+	}
+	data.UpdateJobStatusWithMessage(job.GUID, models.JobError, err.Error())
+	notify(job.GUID, models.WebhookJobFailed, 0, err)
+	publishResult(job.GUID, err)
+}
+
+// handBack returns a job interrupted by its worker shutting down to the
+// dispatcher, to resume from the stage it was in. Uploads encode again, as
+// the outputs may go with the worker.
+func handBack(job models.Job) {
+	stage := ""
+	if l := getLease(job.GUID); l != nil && job.Action == "transcode" {
+		l.mu.Lock()
+		stage = l.stage
+		l.mu.Unlock()
+	}
+	if stage == StageUpload {
+		stage = StageEncode
+	}
+
+	// Hand back the dispatch this worker was released with only.
+	current, err := data.GetJobByGUID(job.GUID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	msg := "worker shut down, requeued"
+	if current.Status != models.JobRetrying {
+		if err := data.UpdateJobStatusWithMessage(job.GUID, models.JobRetrying, msg); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+	if stage == "" {
+		if err := data.UpdateJobStatusWithMessage(job.GUID, models.JobQueued, msg); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+	if err := data.MarkJobPending(job.GUID, stage, current.DispatchedDate); err != nil {
+		log.Error(err)
+	}
+}
+
+// publishResult publishes the outcome of a job back to the requesting system.
+func publishResult(guid string, jobErr error) {
+	if err := results.Publish(guid, jobErr); err != nil {
+		log.Error(err)
+	}
+}
+
+// notify queues a lifecycle webhook for a job, logging failures to record it.
+func notify(guid, event string, progress float64, jobErr error) {
+	if err := webhook.Notify(guid, event, progress, jobErr); err != nil {
+		log.Error(err)
+	}
+}
+
+func formatMetadata(meta models.JobMetadata) string {
+	if len(meta) == 0 {
+		return "-"
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return "-"
+	}
+	return string(b)
+}
+
+// RunDownloadJob runs the download pipeline of a job. Transient failures are
+// retried per stage; the returned error is final.
+func RunDownloadJob(job models.Job) error {
 	//job.LocalSource = helpers.CreateLocalSourcePath(
 	//	config.Get().WorkDirectory, localPath, job.GUID)
 
+	notify(job.GUID, models.WebhookJobStarted, 0, nil)
+
+	l := startLease(job, StageDownload)
+	defer l.release()
+
 	// 1. Download.
-	err := download(job)
+	err := runStage(job, StageDownload, func() error {
+		return download(job)
+	})
 	if err != nil {
-		log.Error(err)
-		data.UpdateJobStatus(job.GUID, models.JobError)
-		return
+		FailJob(job, err)
+		return err
 	}
 	completeDownload(job)
 	if err != nil {
 		log.Error(err)
 	}
+	notify(job.GUID, models.WebhookJobCompleted, 100, nil)
+	publishResult(job.GUID, nil)
+	return nil
 }
 
-func PrepareEncodeJob(job models.Job) {
-	minCpu, maxCpu := getCPULevels()
-	minMem, maxMem := getMemoryLevels()
-	parallelism := "1"
-	maxRetries := "1"
-	kubeJob := createKubeJob(job.C24JobID, job.Action, parallelism, maxRetries, minMem, maxMem, minCpu, maxCpu)
-	_, err := shipKubeJob(kubeJob)
-	if err != nil {
-		log.Fatal(err)
-	}
+// RunEncodeJob runs the probe, encode and upload pipeline of a job. Transient
+// failures are retried per stage; the returned error is final.
+func RunEncodeJob(job models.Job) error {
+	return RunEncodeJobFrom(job, "")
 }
 
-func RunEncodeJob(job models.Job) {
+// RunEncodeJobFrom runs the pipeline of a job starting at the given stage,
+// skipping the stages before it. A source left by an earlier run is reused
+// unless the download stage is asked for.
+func RunEncodeJobFrom(job models.Job, stage string) error {
+	if stage == "" {
+		stage = StageProbe
+	}
 
 	sourceMediaPath := getSourceMediaPath(job.C24JobID)
 	err := helpers.FileExists(sourceMediaPath)
 
-	// 2. Probe data.
-	probeData, err := probe(job)
-	if err != nil {
-		log.Error(err)
-		data.UpdateJobStatus(job.GUID, models.JobError)
-		return
+	notify(job.GUID, models.WebhookJobStarted, 0, nil)
+
+	l := startLease(job, stage)
+	defer l.release()
+
+	// 1. Download the source when asked to or when an encode needs it.
+	fetched := stage == StageDownload || (err != nil && stageRuns(stage, StageEncode))
+	if fetched {
+		err = runStage(job, StageDownload, func() error {
+			return fetchSource(job)
+		})
+		if err != nil {
+			FailJob(job, err)
+			return err
+		}
+	}
+
+	// 2. Probe data. A fresh source or missing probe data is probed again.
+	probeData := storedProbeData(job)
+	if stageRuns(stage, StageProbe) || (stageRuns(stage, StageEncode) && (fetched || probeData == nil)) {
+		err = runStage(job, StageProbe, func() (err error) {
+			probeData, err = probe(job)
+			return err
+		})
+		if err != nil {
+			FailJob(job, err)
+			return err
+		}
 	}
 
 	// 3. Encode.
-	err = encode(job, probeData)
-	if err != nil {
-		log.Error(err)
-		data.UpdateJobStatus(job.GUID, models.JobError)
-		return
+	if stageRuns(stage, StageEncode) {
+		err = runStage(job, StageEncode, func() error {
+			return encode(job, probeData)
+		})
+		if err != nil {
+			FailJob(job, err)
+			return err
+		}
 	}
 
 	// 4. Upload.
-	err = upload(job)
+	err = runStage(job, StageUpload, func() error {
+		return upload(job)
+	})
 	if err != nil {
-		log.Error(err)
-		data.UpdateJobStatus(job.GUID, models.JobError)
-		return
+		FailJob(job, err)
+		return err
 	}
 
 	// 5. Cleanup.
 	//err = cleanup(job)
 	//if err != nil {
 	//	log.Error(err)
-	//	data.UpdateJobStatus(job.GUID, models.JobError)
+	//	data.UpdateJobStatusWithMessage(job.GUID, models.JobError, err.Error())
 	//	return
 	//}
 
@@ -288,6 +564,13 @@ func RunEncodeJob(job models.Job) {
 		log.Error(err)
 	}
 
+	// Reload the stored job so notifications carry its metadata and outputs.
+	if stored, err := data.GetJobByGUID(job.GUID); err == nil {
+		job = *stored
+	}
+	notify(job.GUID, models.WebhookJobCompleted, 100, nil)
+	publishResult(job.GUID, nil)
+
 	// 7. Alert
 	notifyCompletion(job)
 	if err != nil {
@@ -299,29 +582,77 @@ func RunEncodeJob(job models.Job) {
 	if err != nil {
 		log.Error(err)
 	}
+	return nil
 }
 
-func trackEncodeProgress(encodeID int64, p *ffprobe.FFProbeResponse, f *transcode.FFmpeg) {
-	progressCh = make(chan struct{})
+func trackEncodeProgress(guid string, encodeID int64, p *ffprobe.FFProbeResponse, f *transcode.FFmpeg, done chan struct{}) {
 	ticker := time.NewTicker(progressInterval)
+	milestone := progressMilestone
 
 	for {
 		select {
-		case <-progressCh:
+		case <-done:
 			ticker.Stop()
 			return
 		case <-ticker.C:
+			if status, err := data.GetJobStatus(guid); err == nil && status == models.JobCancelled {
+				log.Infof("job %s cancelled, stopping encode", guid)
+				f.Stop()
+			}
+			if err := leaseStopped(guid); err != nil {
+				log.Infof("job %s: %v, stopping encode", guid, err)
+				f.Stop()
+			}
+
+			// Sources without a frame count report no progress.
 			currentFrame := f.Progress.Frame
-			totalFrames, _ := strconv.Atoi(p.Streams[0].NbFrames)
-
-			pct := (float64(currentFrame) / float64(totalFrames)) * 100
+			totalFrames := videoFrameCount(p)
+			pct, ok := encodeProgress(currentFrame, totalFrames)
+			if !ok {
+				continue
+			}
 
 			// Update DB with progress.
-			pct = math.Round(pct*100) / 100
 			fmt.Printf("progress: %d / %d - %0.2f%%\r", currentFrame, totalFrames, pct)
 			data.UpdateEncodeProgressByID(encodeID, pct)
+			setLeaseProgress(guid, pct)
+
+			// Notify on each progress milestone crossed.
+			if pct >= milestone && milestone < 100 {
+				go notify(guid, models.WebhookJobProgress, pct, nil)
+				for milestone <= pct {
+					milestone += progressMilestone
+				}
+			}
+		}
+	}
+}
+
+// videoFrameCount returns the frame count of the first video stream of a
+// source, or 0 when it is unknown.
+func videoFrameCount(p *ffprobe.FFProbeResponse) int {
+	if p == nil {
+		return 0
+	}
+	for _, s := range p.Streams {
+		if s.CodecType == "video" && s.Disposition.AttachedPic == 0 {
+			n, _ := strconv.Atoi(s.NbFrames)
+			return n
 		}
 	}
+	return 0
+}
+
+// encodeProgress returns the percentage of frames encoded, rounded to two
+// decimals and clamped to [0, 100]. It reports false when the total is
+// unknown.
+func encodeProgress(current, total int) (float64, bool) {
+	if total <= 0 {
+		return 0, false
+	}
+	pct := (float64(current) / float64(total)) * 100
+	pct = math.Round(pct*100) / 100
+	return math.Max(0, math.Min(100, pct)), true
 }
 
 func trackTransferProgress(encodeID int64, d *storage.S3) {
@@ -340,59 +671,27 @@ func trackTransferProgress(encodeID int64, d *storage.S3) {
 	}
 }
 
-func createKubeJob(jobName, action, parallelism, maxRetries, memMin, memMax, cpuMin, cpuMax string) *batchv1.Job {
-
-	actionArg := "transcoder"
-	if action == "download" {
-		actionArg = "downloader"
-	}
-
-	j := kube.New(
-		kube.WithJobNameEnv(jobName),
-		kube.WithCommandArgs(actionArg),
-		kube.WithJobName(jobName),
-		kube.WithMaxParallelism(parallelism),
-		kube.WithMaxRetries(maxRetries),
-		kube.WithTTLCleanupTime(int32(0)),
-		kube.WithResourceLimit(cpuMax, memMax),
-		kube.WithResourceRequest(cpuMin, memMin),
-	)
-	return j
+func getSourceMediaPath(c24JobID string) string {
+	log.Info("smedia", c24JobID)
+	path := fmt.Sprintf("%s/src/%s", config.Get().WorkDirectory, c24JobID)
+	return path
+}
 
+func getOutputMediaPath(c24JobID, profile, ext string) string {
+	return fmt.Sprintf("%s/dst/%s_%s%s", config.Get().WorkDirectory, c24JobID, profile, ext)
 }
 
-func shipKubeJob(job *batchv1.Job) (batchv1.Job, error) {
-	conf, err := rest.InClusterConfig()
-	if err != nil {
-		log.Fatal(err)
+// getOutputURL returns where an output is uploaded to. A job with a single
+// output uploads to its destination; with several, the destination is used
+// as a prefix unless the output names its own.
+func getOutputURL(job models.Job, o models.JobOutput, ext string, count int) string {
+	if o.URL != "" {
+		return o.URL
 	}
-	// create the clientset
-	clientset, err := kubernetes.NewForConfig(conf)
-	if err != nil {
-		log.Fatal(err)
-	}
-	jobResp, err := clientset.BatchV1().Jobs("jobs").Create(job)
-	if err != nil {
-		log.Fatal(err)
+	if count == 1 {
+		return job.Destination
 	}
-	log.Info(jobResp.Name, jobResp.Status)
-	return *jobResp, nil
-}
-
-func getMemoryLevels() (string, string) {
-	// TODO: Pull defaults from config
-	return "2000M", "2000M"
-}
-
-func getCPULevels() (string, string) {
-	// TODO: Pull defaults from config
-	return "750m", "750m"
-}
-
-func getSourceMediaPath(c24JobID string) string {
-	log.Info("smedia", c24JobID)
-	path := fmt.Sprintf("%s/src/%s", config.Get().WorkDirectory, c24JobID)
-	return path
+	return fmt.Sprintf("%s/%s_%s%s", strings.TrimSuffix(job.Destination, "/"), job.C24JobID, o.Profile, ext)
 }
 
 func stripServiceFromURL(url string) string {
@@ -0,0 +1,54 @@
+package actions
+
+import (
+	"testing"
+
+	ffprobe "github.com/harisbeha/media-transcoder/internal/probe"
+)
+
+func TestEncodeProgress(t *testing.T) {
+	tests := []struct {
+		current, total int
+		want           float64
+		ok             bool
+	}{
+		{0, 0, 0, false},
+		{10, 0, 0, false},
+		{0, -1, 0, false},
+		{0, 100, 0, true},
+		{1, 3, 33.33, true},
+		{100, 100, 100, true},
+		{150, 100, 100, true},
+		{-5, 100, 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := encodeProgress(tt.current, tt.total)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("encodeProgress(%d, %d) = %v, %v, want %v, %v", tt.current, tt.total, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestVideoFrameCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		streams []ffprobe.Stream
+		want    int
+	}{
+		{"none", nil, 0},
+		{"audio first", []ffprobe.Stream{
+			{CodecType: "audio"},
+			{CodecType: "video", NbFrames: "240"},
+		}, 240},
+		{"unknown count", []ffprobe.Stream{{CodecType: "video"}}, 0},
+	}
+	for _, tt := range tests {
+		got := videoFrameCount(&ffprobe.FFProbeResponse{Streams: tt.streams})
+		if got != tt.want {
+			t.Errorf("%s: videoFrameCount = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if got := videoFrameCount(nil); got != 0 {
+		t.Errorf("videoFrameCount(nil) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,92 @@
+package actions
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	data "github.com/harisbeha/media-transcoder/internal/data"
+)
+
+// ErrCancelled is returned by a stage stopped because its job was cancelled.
+var ErrCancelled = errors.New("job cancelled")
+
+// ErrLeaseLost is returned by a stage stopped because the worker lost the
+// lease on its job, which was reaped and handed on.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// ErrInterrupted is returned by a stage stopped because its worker is
+// shutting down.
+var ErrInterrupted = errors.New("worker shutting down")
+
+// ErrSourceMissing is returned by a probe that finds no source to probe. It
+// is retried, as the source may not have landed on a shared volume yet.
+var ErrSourceMissing = errors.New("source media missing")
+
+// PermanentError marks a failure that retrying cannot fix, such as bad input.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Permanent wraps err as a PermanentError.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// transientMarkers are fragments of error messages from the network, gsutil
+// and cloud storage that indicate a failure worth retrying.
+var transientMarkers = []string{
+	"timeout",
+	"timed out",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"temporarily unavailable",
+	"too many requests",
+	"toomanyrequests",
+	"serviceexception: 5",
+	"internalerror",
+	"backenderror",
+	"slowdown",
+	" 500 ",
+	" 502 ",
+	" 503 ",
+	" 504 ",
+	" 429 ",
+}
+
+// IsTransient reports whether err is worth retrying: network errors,
+// storage 5xx or throttling responses and a missing source. Everything else, including errors
+// marked Permanent, is treated as permanent.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(*PermanentError); ok {
+		return false
+	}
+	if err == data.ErrInvalidTransition || err == ErrCancelled || err == ErrLeaseLost || err == ErrInterrupted {
+		return false
+	}
+	if err == ErrSourceMissing {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	msg := " " + strings.ToLower(err.Error()) + " "
+	for _, m := range transientMarkers {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gocraft/work"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+)
+
+// lease is a worker's claim on the job it runs, renewed by heartbeats that
+// report the stage and progress of the job. A job whose lease expires is
+// reaped by the server, so a worker that loses its lease stops the job.
+type lease struct {
+	guid string
+	id   string
+	done chan struct{}
+
+	mu       sync.Mutex
+	stage    string
+	progress float64
+	stopped  error
+}
+
+// leases holds the leases of the jobs this process runs, by job GUID.
+var leases = struct {
+	sync.Mutex
+	m map[string]*lease
+}{m: map[string]*lease{}}
+
+// startLease takes the lease on a job and starts renewing it.
+func startLease(job models.Job, stage string) *lease {
+	l := &lease{
+		guid:  job.GUID,
+		id:    xid.New().String(),
+		done:  make(chan struct{}),
+		stage: stage,
+	}
+
+	owner, _ := os.Hostname()
+	if err := data.AcquireLease(l.guid, l.id, owner, stage, leaseDuration()); err != nil {
+		log.Error(err)
+	}
+
+	leases.Lock()
+	leases.m[l.guid] = l
+	leases.Unlock()
+
+	go l.heartbeat()
+	return l
+}
+
+func (l *lease) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			stage, progress := l.stage, l.progress
+			l.mu.Unlock()
+
+			renewed, err := data.RenewLease(l.guid, l.id, stage, progress, leaseDuration())
+			if err != nil {
+				// Keep going; the lease outlasts a few missed heartbeats.
+				log.Error(err)
+				continue
+			}
+			if !renewed {
+				log.Warnf("job %s: lease lost, stopping", l.guid)
+				l.stop(ErrLeaseLost)
+				return
+			}
+		}
+	}
+}
+
+// stop asks the job holding the lease to stop, for the given reason.
+func (l *lease) stop(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped == nil {
+		l.stopped = err
+	}
+}
+
+// release stops renewing the lease and gives it up.
+func (l *lease) release() {
+	close(l.done)
+
+	leases.Lock()
+	if leases.m[l.guid] == l {
+		delete(leases.m, l.guid)
+	}
+	leases.Unlock()
+
+	if err := data.ReleaseLease(l.guid, l.id); err != nil {
+		log.Error(err)
+	}
+}
+
+func getLease(guid string) *lease {
+	leases.Lock()
+	defer leases.Unlock()
+	return leases.m[guid]
+}
+
+// setLeaseStage reports the stage of a job in its next heartbeat.
+func setLeaseStage(guid, stage string) {
+	if l := getLease(guid); l != nil {
+		l.mu.Lock()
+		l.stage = stage
+		l.progress = 0
+		l.mu.Unlock()
+	}
+}
+
+// setLeaseProgress reports the progress of a job in its next heartbeat.
+func setLeaseProgress(guid string, progress float64) {
+	if l := getLease(guid); l != nil {
+		l.mu.Lock()
+		l.progress = progress
+		l.mu.Unlock()
+	}
+}
+
+// leaseStopped returns why a job this process runs has to stop, either
+// ErrLeaseLost or ErrInterrupted, or nil while it may carry on.
+func leaseStopped(guid string) error {
+	if l := getLease(guid); l != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.stopped
+	}
+	return nil
+}
+
+// Interrupt stops the jobs this process runs at their next checkpoint,
+// handing them back to the dispatcher to resume from the stage they were
+// in. Running encodes stop right away; downloads and uploads finish first.
+func Interrupt() {
+	leases.Lock()
+	defer leases.Unlock()
+	for _, l := range leases.m {
+		l.stop(ErrInterrupted)
+	}
+}
+
+// LeaseStatus describes the stage and progress of a job this process runs,
+// or returns "" when it runs no such job.
+func LeaseStatus(guid string) string {
+	l := getLease(guid)
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return fmt.Sprintf("stage=%s progress=%.2f", l.stage, l.progress)
+}
+
+// Checkin is worker pool middleware checking in the stage and progress of
+// the job a worker runs with every heartbeat, so the queue's worker
+// observations show how far running jobs are.
+func Checkin(job *work.Job, next work.NextMiddlewareFunc) error {
+	guid, _ := job.Args["guid"].(string)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if status := LeaseStatus(guid); status != "" {
+					job.Checkin(status)
+				}
+			}
+		}
+	}()
+	return next()
+}
+
+func heartbeatInterval() time.Duration {
+	if d := config.Get().HeartbeatInterval; d > 0 {
+		return d
+	}
+	return leaseDuration() / 4
+}
+
+func leaseDuration() time.Duration {
+	if d := config.Get().LeaseDuration; d > 0 {
+		return d
+	}
+	return 2 * time.Minute
+}
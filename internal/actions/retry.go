@@ -0,0 +1,145 @@
+package actions
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pipeline stages.
+const (
+	StageDownload = "download"
+	StageProbe    = "probe"
+	StageEncode   = "encode"
+	StageUpload   = "upload"
+)
+
+// ExhaustedError is returned by a stage whose transient failures outlasted
+// the job's max attempts.
+type ExhaustedError struct {
+	Stage    string
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("%s failed after %d attempts: %v", e.Stage, e.Attempts, e.Err)
+}
+
+// runStage runs a pipeline stage, retrying transient failures with
+// exponential backoff until the profile's max attempts are used up.
+func runStage(job models.Job, stage string, fn func() error) error {
+	maxAttempts := config.MaxAttempts(job.Profile)
+	setLeaseStage(job.GUID, stage)
+
+	for attempt := 1; ; attempt++ {
+		if err := leaseStopped(job.GUID); err != nil {
+			return err
+		}
+		release := acquireStage(stage)
+		err := fn()
+		release()
+		if err == nil || !IsTransient(err) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			return &ExhaustedError{Stage: stage, Attempts: attempt, Err: err}
+		}
+
+		wait := retryBackoff(attempt)
+		msg := fmt.Sprintf("%s attempt %d/%d failed, retrying in %s: %v", stage, attempt, maxAttempts, wait, err)
+		log.Warn(msg)
+		if err := data.UpdateJobStatusWithMessage(job.GUID, models.JobRetrying, msg); err != nil {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
+
+// stageSlots bounds how many jobs run each stage at once in this process.
+var stageSlots = struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}{m: map[string]chan struct{}{}}
+
+// acquireStage waits for a free slot of a stage and returns the func that
+// frees it. Stages without a configured concurrency don't wait.
+func acquireStage(stage string) func() {
+	n := config.GetStageConcurrency(stage)
+	if n == 0 {
+		return func() {}
+	}
+
+	stageSlots.Lock()
+	slots, ok := stageSlots.m[stage]
+	if !ok {
+		slots = make(chan struct{}, n)
+		stageSlots.m[stage] = slots
+	}
+	stageSlots.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// retryBackoff returns the wait before the next attempt, doubling per
+// attempt up to the configured maximum.
+func retryBackoff(attempt int) time.Duration {
+	wait := config.Get().RetryBackoff
+	if wait <= 0 {
+		wait = time.Second
+	}
+	max := config.Get().RetryMaxBackoff
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if max > 0 && wait >= max {
+			return max
+		}
+	}
+	return wait
+}
+
+// deadLetter adds a job whose retries were exhausted to the dead-letter list.
+func deadLetter(job models.Job, e *ExhaustedError) {
+	j, err := data.GetJobByGUID(job.GUID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	_, err = data.CreateDeadLetter(models.DeadLetter{
+		JobID:    j.ID,
+		Stage:    e.Stage,
+		Error:    e.Err.Error(),
+		Attempts: e.Attempts,
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// Stages lists the pipeline stages in the order they run.
+var Stages = []string{StageDownload, StageProbe, StageEncode, StageUpload}
+
+// IsValidStage reports whether stage is a known pipeline stage.
+func IsValidStage(stage string) bool {
+	return stageIndex(stage) >= 0
+}
+
+func stageIndex(stage string) int {
+	for i, s := range Stages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+// stageRuns reports whether a pipeline started at from runs stage.
+func stageRuns(from, stage string) bool {
+	return stageIndex(stage) >= stageIndex(from)
+}
@@ -0,0 +1,55 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/gocraft/work"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// interruptTimeout bounds the wait for interrupted jobs to hand themselves
+// back once the grace period is over.
+const interruptTimeout = 15 * time.Second
+
+// StopPool stops a worker pool fetching jobs and waits for its running jobs
+// to finish. Jobs still running after the shutdown grace period are
+// interrupted and handed back to the dispatcher.
+func StopPool(pool *work.WorkerPool) {
+	stopped := make(chan struct{})
+	go func() {
+		pool.Stop()
+		close(stopped)
+	}()
+
+	grace := ShutdownGracePeriod()
+	select {
+	case <-stopped:
+		return
+	case <-time.After(grace):
+	}
+
+	log.Warnf("worker: jobs still running after %s, interrupting them", grace)
+	Interrupt()
+	select {
+	case <-stopped:
+	case <-time.After(interruptTimeout):
+		log.Warn("worker: stopping with jobs still running")
+	}
+}
+
+// ShutdownGracePeriod returns how long a stopping worker lets its running
+// jobs finish before interrupting them.
+func ShutdownGracePeriod() time.Duration {
+	if d := config.Get().ShutdownGracePeriod; d > 0 {
+		return d
+	}
+	return 25 * time.Second
+}
+
+// TerminationGracePeriod returns how long a worker may take to stop: the
+// shutdown grace period, plus time to hand interrupted jobs back and archive
+// its log.
+func TerminationGracePeriod() time.Duration {
+	return ShutdownGracePeriod() + interruptTimeout + 15*time.Second
+}
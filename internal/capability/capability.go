@@ -0,0 +1,167 @@
+// Package capability describes what a worker can run, its ffmpeg encoders,
+// the largest resolution it takes, its scratch space and its tags, and what
+// the profiles of a job require of one, so the dispatcher routes jobs only
+// to workers able to run them.
+package capability
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/helpers"
+	log "github.com/sirupsen/logrus"
+)
+
+const ffmpegCmd = "ffmpeg"
+
+// Capabilities are what a worker advertises. Workers with the same
+// encoders, resolution and tags form a group sharing a work queue.
+type Capabilities struct {
+	WorkerID     string    `json:"worker_id"`
+	Pool         string    `json:"pool"`
+	Host         string    `json:"host"`
+	Pid          int       `json:"pid"`
+	Group        string    `json:"group"`
+	Encoders     []string  `json:"encoders"`
+	MaxWidth     int       `json:"max_width"`
+	MaxHeight    int       `json:"max_height"`
+	ScratchBytes int64     `json:"scratch_bytes"`
+	Tags         []string  `json:"tags"`
+	StartedDate  time.Time `json:"started_date"`
+	SeenDate     time.Time `json:"seen_date"`
+}
+
+// Probe finds the capabilities of this process as a worker of the given
+// pool: the encoders of its ffmpeg build, the free space of its work
+// directory, and the max resolution and tags it is configured with.
+func Probe(pool string) *Capabilities {
+	host, _ := os.Hostname()
+	c := &Capabilities{
+		WorkerID:    helpers.WorkerID(),
+		Pool:        pool,
+		Host:        host,
+		Pid:         os.Getpid(),
+		Tags:        sortedCopy(config.Get().WorkerTags),
+		StartedDate: time.Now(),
+	}
+
+	encoders, err := probeEncoders()
+	if err != nil {
+		log.Warnf("capability: could not list ffmpeg encoders: %v", err)
+	}
+	c.Encoders = encoders
+
+	if r := config.Get().WorkerMaxResolution; r != "" {
+		if c.MaxWidth, c.MaxHeight, err = ParseResolution(r); err != nil {
+			log.Warnf("capability: worker_max_resolution: %v", err)
+		}
+	}
+
+	c.ScratchBytes = scratchBytes()
+	c.Group = group(c)
+	return c
+}
+
+// Refresh probes the capabilities that change while the worker runs.
+func (c *Capabilities) Refresh() {
+	c.ScratchBytes = scratchBytes()
+}
+
+// Unlimited reports whether the worker takes sources of any resolution.
+func (c *Capabilities) Unlimited() bool {
+	return c.MaxWidth == 0 || c.MaxHeight == 0
+}
+
+// probeEncoders lists the encoders of the ffmpeg build, sorted.
+func probeEncoders() ([]string, error) {
+	out, err := exec.Command(ffmpegCmd, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return []string{}, err
+	}
+
+	// Encoders follow a legend ending in a line of dashes, one per line
+	// as flags, name and description.
+	encoders := []string{}
+	listed := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !listed {
+			listed = strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	sort.Strings(encoders)
+	return encoders, scanner.Err()
+}
+
+// scratchBytes returns the free space of the work directory.
+func scratchBytes() int64 {
+	dir := config.Get().WorkDirectory
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		log.Warnf("capability: could not stat work directory: %v", err)
+		return 0
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize)
+}
+
+// group hashes the capabilities workers share a work queue by. Scratch
+// space varies as jobs run, so it is checked per worker instead.
+func group(c *Capabilities) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n%dx%d\n%s",
+		strings.Join(c.Encoders, ","), c.MaxWidth, c.MaxHeight, strings.Join(c.Tags, ","))
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// ParseResolution parses a resolution given as WIDTHxHEIGHT, or as a
+// height with a p suffix for a 16:9 frame, e.g. 2160p.
+func ParseResolution(s string) (width, height int, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasSuffix(s, "p") {
+		height, err = strconv.Atoi(strings.TrimSuffix(s, "p"))
+		if err != nil || height <= 0 {
+			return 0, 0, fmt.Errorf("invalid resolution %q", s)
+		}
+		return height * 16 / 9, height, nil
+	}
+
+	parts := strings.Split(s, "x")
+	if len(parts) == 2 {
+		width, err = strconv.Atoi(parts[0])
+		if err == nil {
+			height, err = strconv.Atoi(parts[1])
+		}
+		if err == nil && width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid resolution %q", s)
+}
+
+func sortedCopy(s []string) []string {
+	c := append([]string{}, s...)
+	sort.Strings(c)
+	return c
+}
@@ -0,0 +1,164 @@
+package capability
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResolution(t *testing.T) {
+	tests := []struct {
+		in            string
+		width, height int
+		wantErr       bool
+	}{
+		{"1920x1080", 1920, 1080, false},
+		{" 3840X2160 ", 3840, 2160, false},
+		{"1080x1920", 1080, 1920, false},
+		{"2160p", 3840, 2160, false},
+		{"720P", 1280, 720, false},
+		{"0x1080", 0, 0, true},
+		{"1920x", 0, 0, true},
+		{"1920x1080x3", 0, 0, true},
+		{"p", 0, 0, true},
+		{"-720p", 0, 0, true},
+		{"", 0, 0, true},
+	}
+	for _, tt := range tests {
+		width, height, err := ParseResolution(tt.in)
+		if (err != nil) != tt.wantErr || width != tt.width || height != tt.height {
+			t.Errorf("ParseResolution(%q) = %d, %d, %v, want %d, %d, error %v",
+				tt.in, width, height, err, tt.width, tt.height, tt.wantErr)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	worker := Capabilities{
+		Encoders:     []string{"aac", "libvpx", "libx264"},
+		MaxWidth:     1920,
+		MaxHeight:    1080,
+		ScratchBytes: 10 << 30,
+		Tags:         []string{"gpu"},
+	}
+	unlimited := worker
+	unlimited.MaxWidth, unlimited.MaxHeight = 0, 0
+
+	tests := []struct {
+		name   string
+		worker Capabilities
+		r      Requirements
+		want   bool
+	}{
+		{"nothing required", worker, Requirements{}, true},
+		{"encoders present", worker, Requirements{Encoders: []string{"aac", "libx264"}}, true},
+		{"encoder missing", worker, Requirements{Encoders: []string{"libx265"}}, false},
+		{"tag present", worker, Requirements{Tags: []string{"gpu"}}, true},
+		{"tag missing", worker, Requirements{Tags: []string{"hdr"}}, false},
+		{"enough scratch", worker, Requirements{ScratchBytes: 10 << 30}, true},
+		{"too little scratch", worker, Requirements{ScratchBytes: 20 << 30}, false},
+		{"resolution fits", worker, Requirements{MaxWidth: 1920, MaxHeight: 1080}, true},
+		{"resolution too large", worker, Requirements{MaxWidth: 3840, MaxHeight: 2160}, false},
+		{"any resolution", unlimited, Requirements{MaxWidth: 3840, MaxHeight: 2160}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.worker.Satisfies(tt.r); got != tt.want {
+			t.Errorf("%s: Satisfies = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolutionIsLandscape(t *testing.T) {
+	var r Requirements
+	r.Resolution(1080, 1920)
+	r.Resolution(1280, 720)
+	if r.MaxWidth != 1920 || r.MaxHeight != 1080 {
+		t.Errorf("resolution = %dx%d, want 1920x1080", r.MaxWidth, r.MaxHeight)
+	}
+
+	// A portrait worker takes the same frames as a landscape one.
+	worker := Capabilities{MaxWidth: 1080, MaxHeight: 1920}
+	if !worker.Satisfies(r) {
+		t.Error("1080x1920 worker does not satisfy a 1920x1080 requirement")
+	}
+}
+
+func TestOptionEncoders(t *testing.T) {
+	options := []string{
+		"-sn",
+		"-f mp4",
+		"-acodec aac",
+		"-vcodec libx264",
+		"-c:s copy",
+		`-c:v "libvpx"`,
+		"-vb 256k",
+	}
+	want := []string{"aac", "libx264", "libvpx"}
+	if got := optionEncoders(options); !reflect.DeepEqual(got, want) {
+		t.Errorf("optionEncoders = %v, want %v", got, want)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	workers := []Capabilities{
+		{WorkerID: "a", Pool: "transcode", Group: "small", Encoders: []string{"libx264"}, MaxWidth: 1920, MaxHeight: 1080},
+		{WorkerID: "b", Pool: "transcode", Group: "large", Encoders: []string{"libx264", "libx265"}},
+		{WorkerID: "c", Pool: "transcode", Group: "large", Encoders: []string{"libx264", "libx265"}},
+		{WorkerID: "d", Pool: "download", Group: "other", Encoders: []string{"libx264", "libvpx"}},
+		// One worker of a group short of an encoder rules the group out.
+		{WorkerID: "e", Pool: "transcode", Group: "mixed", Encoders: []string{"libvpx", "libx264"}},
+		{WorkerID: "f", Pool: "transcode", Group: "mixed", Encoders: []string{"libx264"}},
+	}
+	first := func(int) int { return 0 }
+	last := func(n int) int { return n - 1 }
+
+	tests := []struct {
+		name string
+		r    Requirements
+		pick func(int) int
+		want string
+		err  error
+	}{
+		{"one group qualifies", Requirements{Encoders: []string{"libx265"}}, first, "large", nil},
+		{"resolution rules out a group", Requirements{Encoders: []string{"libx264"}, MaxWidth: 3840, MaxHeight: 2160}, last, "mixed", nil},
+		{"groups drawn by size, first", Requirements{Encoders: []string{"libx264"}}, first, "large", nil},
+		{"groups drawn by size, last", Requirements{Encoders: []string{"libx264"}}, last, "small", nil},
+		{"other pools are ignored", Requirements{Encoders: []string{"libvpx"}}, first, "", ErrNoCapableWorker},
+		{"no group qualifies", Requirements{Tags: []string{"gpu"}}, first, "", ErrNoCapableWorker},
+	}
+	for _, tt := range tests {
+		got, err := route(workers, "transcode", tt.r, tt.pick)
+		if got != tt.want || err != tt.err {
+			t.Errorf("%s: route = %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRouteWeighsGroupsBySize(t *testing.T) {
+	workers := []Capabilities{
+		{WorkerID: "a", Pool: "transcode", Group: "one"},
+		{WorkerID: "b", Pool: "transcode", Group: "three"},
+		{WorkerID: "c", Pool: "transcode", Group: "three"},
+		{WorkerID: "d", Pool: "transcode", Group: "three"},
+	}
+	r := Requirements{ScratchBytes: 0, MaxWidth: 640, MaxHeight: 360}
+	counts := map[string]int{}
+	for n := 0; n < 4; n++ {
+		g, err := route(workers, "transcode", r, func(int) int { return n })
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[g]++
+	}
+	if counts["one"] != 1 || counts["three"] != 3 {
+		t.Errorf("picks = %v, want one 1 and three 3", counts)
+	}
+}
+
+func TestJobName(t *testing.T) {
+	if got := JobName("transcode", ""); got != "transcode" {
+		t.Errorf("JobName without a group = %q", got)
+	}
+	if got := JobName("transcode", "ab12cd34"); got != "transcode@ab12cd34" {
+		t.Errorf("JobName = %q, want transcode@ab12cd34", got)
+	}
+}
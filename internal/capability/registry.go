@@ -0,0 +1,171 @@
+package capability
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// workersKey holds the advertised capabilities of live workers, by worker
+// ID.
+const workersKey = "c24-media:workers"
+
+// ErrNoCapableWorker is returned for a job no live worker can run.
+var ErrNoCapableWorker = errors.New("no worker capable of running the job")
+
+// Advertise registers a worker's capabilities and refreshes them every
+// heartbeat until ctx is done, then withdraws them.
+func Advertise(ctx context.Context, pool *redis.Pool, c *Capabilities) {
+	ticker := time.NewTicker(advertiseInterval())
+	defer ticker.Stop()
+
+	for {
+		c.SeenDate = time.Now()
+		if err := register(pool, c); err != nil {
+			log.Error(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := deregister(pool, c.WorkerID); err != nil {
+				log.Error(err)
+			}
+			return
+		case <-ticker.C:
+			c.Refresh()
+		}
+	}
+}
+
+func register(pool *redis.Pool, c *Capabilities) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("HSET", workersKey, c.WorkerID, b)
+	return err
+}
+
+func deregister(pool *redis.Pool, workerID string) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("HDEL", workersKey, workerID)
+	return err
+}
+
+// List returns the capabilities of the live workers, sorted by worker ID.
+// Workers that missed a few heartbeats are dropped.
+func List(pool *redis.Pool) ([]Capabilities, error) {
+	conn := pool.Get()
+	defer conn.Close()
+	values, err := redis.StringMap(conn.Do("HGETALL", workersKey))
+	if err != nil {
+		return nil, err
+	}
+
+	expired := time.Now().Add(-3 * advertiseInterval())
+	workers := []Capabilities{}
+	for id, v := range values {
+		var c Capabilities
+		if err := json.Unmarshal([]byte(v), &c); err != nil || c.SeenDate.Before(expired) {
+			conn.Do("HDEL", workersKey, id)
+			continue
+		}
+		workers = append(workers, c)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].WorkerID < workers[j].WorkerID })
+	return workers, nil
+}
+
+// Groups returns the groups of the live workers of a pool.
+func Groups(pool *redis.Pool, workerPool string) ([]string, error) {
+	workers, err := List(pool)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, w := range workers {
+		if w.Pool == workerPool {
+			seen[w.Group] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// Route picks the group of workers of a pool to run a job with the given
+// requirements, or "" for any worker when it has none. A group qualifies
+// when all its live workers satisfy the requirements, as any of them may
+// take the job; larger groups are picked more often. It returns
+// ErrNoCapableWorker when no group qualifies.
+func Route(pool *redis.Pool, workerPool string, r Requirements) (string, error) {
+	if r.IsZero() {
+		return "", nil
+	}
+	workers, err := List(pool)
+	if err != nil {
+		return "", err
+	}
+	return route(workers, workerPool, r, rand.Intn)
+}
+
+// route picks a group of the given workers as Route does, using pick to
+// draw a worker at random from the n of the qualifying groups.
+func route(workers []Capabilities, workerPool string, r Requirements, pick func(n int) int) (string, error) {
+	sizes := map[string]int{}
+	unfit := map[string]bool{}
+	for i, w := range workers {
+		if w.Pool != workerPool {
+			continue
+		}
+		sizes[w.Group]++
+		if !workers[i].Satisfies(r) {
+			unfit[w.Group] = true
+		}
+	}
+
+	total := 0
+	groups := []string{}
+	for g, size := range sizes {
+		if !unfit[g] {
+			groups = append(groups, g)
+			total += size
+		}
+	}
+	sort.Strings(groups)
+	if total == 0 {
+		return "", ErrNoCapableWorker
+	}
+
+	n := pick(total)
+	for _, g := range groups {
+		if n < sizes[g] {
+			return g, nil
+		}
+		n -= sizes[g]
+	}
+	return groups[len(groups)-1], nil
+}
+
+// JobName returns the work queue job name of a group of workers.
+func JobName(base, group string) string {
+	if group == "" {
+		return base
+	}
+	return base + "@" + group
+}
+
+func advertiseInterval() time.Duration {
+	if d := config.Get().HeartbeatInterval; d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
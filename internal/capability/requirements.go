@@ -0,0 +1,160 @@
+package capability
+
+import (
+	"sort"
+	"strings"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Requirements are what a job needs of the worker running it.
+type Requirements struct {
+	Encoders     []string `json:"encoders,omitempty"`
+	MaxWidth     int      `json:"max_width,omitempty"`
+	MaxHeight    int      `json:"max_height,omitempty"`
+	ScratchBytes int64    `json:"scratch_bytes,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+}
+
+// codecFlags are the ffmpeg options naming an encoder.
+var codecFlags = []string{"-vcodec", "-acodec", "-scodec", "-c", "-codec"}
+
+// Require merges the requirements of a job's profiles: every encoder their
+// options name or they list, the largest resolution and scratch space, and
+// every tag. Unknown profiles and values that don't parse are skipped.
+func Require(profiles []string) Requirements {
+	var r Requirements
+	encoders := map[string]bool{}
+	tags := map[string]bool{}
+
+	for _, name := range profiles {
+		p, err := config.GetFFmpegProfile(name)
+		if err != nil {
+			continue
+		}
+		for _, e := range append(optionEncoders(p.Options), p.Requires.Encoders...) {
+			encoders[e] = true
+		}
+		for _, t := range p.Requires.Tags {
+			tags[t] = true
+		}
+
+		if p.Requires.MaxResolution != "" {
+			width, height, err := ParseResolution(p.Requires.MaxResolution)
+			if err != nil {
+				log.Warnf("capability: profile %s: %v", name, err)
+			} else {
+				r.Resolution(width, height)
+			}
+		}
+
+		if p.Requires.Scratch != "" {
+			q, err := resource.ParseQuantity(p.Requires.Scratch)
+			if err != nil {
+				log.Warnf("capability: profile %s: invalid scratch %q", name, p.Requires.Scratch)
+			} else if q.Value() > r.ScratchBytes {
+				r.ScratchBytes = q.Value()
+			}
+		}
+	}
+
+	r.Encoders = sortedKeys(encoders)
+	r.Tags = sortedKeys(tags)
+	return r
+}
+
+// Resolution raises the resolution a job requires to at least that of a
+// frame, e.g. of its source. Resolutions are kept landscape.
+func (r *Requirements) Resolution(width, height int) {
+	if l := long(width, height); l > r.MaxWidth {
+		r.MaxWidth = l
+	}
+	if s := short(width, height); s > r.MaxHeight {
+		r.MaxHeight = s
+	}
+}
+
+// IsZero reports whether any worker satisfies the requirements.
+func (r Requirements) IsZero() bool {
+	return len(r.Encoders) == 0 && r.MaxWidth == 0 && r.MaxHeight == 0 &&
+		r.ScratchBytes == 0 && len(r.Tags) == 0
+}
+
+// Satisfies reports whether a worker meets requirements. Resolutions are
+// compared side by side regardless of orientation; a worker with no max
+// resolution takes any.
+func (c *Capabilities) Satisfies(r Requirements) bool {
+	if !contains(c.Encoders, r.Encoders) || !contains(c.Tags, r.Tags) {
+		return false
+	}
+	if r.ScratchBytes > c.ScratchBytes {
+		return false
+	}
+	if !c.Unlimited() {
+		if r.MaxWidth > long(c.MaxWidth, c.MaxHeight) || r.MaxHeight > short(c.MaxWidth, c.MaxHeight) {
+			return false
+		}
+	}
+	return true
+}
+
+// optionEncoders returns the encoders named in ffmpeg options, leaving out
+// streams that are copied.
+func optionEncoders(options []string) []string {
+	encoders := []string{}
+	var args []string
+	for _, o := range options {
+		args = append(args, strings.Fields(o)...)
+	}
+	for i := 0; i+1 < len(args); i++ {
+		if isCodecFlag(args[i]) && args[i+1] != "copy" {
+			encoders = append(encoders, strings.Trim(args[i+1], `"'`))
+		}
+	}
+	return encoders
+}
+
+func isCodecFlag(arg string) bool {
+	for _, f := range codecFlags {
+		if arg == f || strings.HasPrefix(arg, f+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether the sorted list has every wanted value.
+func contains(sorted, wanted []string) bool {
+	for _, w := range wanted {
+		i := sort.SearchStrings(sorted, w)
+		if i == len(sorted) || sorted[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+func long(width, height int) int {
+	if width > height {
+		return width
+	}
+	return height
+}
+
+func short(width, height int) int {
+	if width < height {
+		return width
+	}
+	return height
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,74 +2,37 @@ package c24_media
 
 import (
 	"cloud.google.com/go/pubsub"
-	"cloud.google.com/go/storage"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/spf13/viper"
-	"golang.org/x/oauth2"
-	"log"
-)
-
-var (
-	OAuthConfig       *oauth2.Config
-	StorageBucket     *storage.BucketHandle
-	StorageBucketName string
-	PubsubClient      *pubsub.Client
+	"strings"
+	"sync"
+	"time"
 )
 
 const PubsubTopicID = "c24-transcode-jobs"
 const PubsubTopicSubscription = "c24-transcode-jobs-sub"
 
-func init() {
-	var err error
-
-	// [START storage]
-	// To configure Cloud Storage, uncomment the following lines and update the
-	// bucket name.
-	//
-	StorageBucketName = "dev-experiments"
-	StorageBucket, err = configureStorage(StorageBucketName)
-	// [END storage]
-
-	PubsubClient, err = configurePubsub("coresystem-171219")
-	// [END pubsub]
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func configureStorage(bucketID string) (*storage.BucketHandle, error) {
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return client.Bucket(bucketID), nil
-}
+var (
+	clientsMu    sync.Mutex
+	pubsubClient *pubsub.Client
+)
 
-func configurePubsub(projectID string) (*pubsub.Client, error) {
+// PubsubClient returns a Pub/Sub client for the configured project. The
+// client is created on first use and shared afterwards.
+func PubsubClient(ctx context.Context) (*pubsub.Client, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
 
-	ctx := context.Background()
-	client, err := pubsub.NewClient(ctx, projectID)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create the topic if it doesn't exist.
-	if exists, err := client.Topic(PubsubTopicID).Exists(ctx); err != nil {
-		return nil, err
-	} else if !exists {
-		if _, err := client.CreateTopic(ctx, PubsubTopicID); err != nil {
+	if pubsubClient == nil {
+		client, err := pubsub.NewClient(ctx, C.PubsubProjectID)
+		if err != nil {
 			return nil, err
 		}
+		pubsubClient = client
 	}
-	return client, nil
+	return pubsubClient, nil
 }
 
 // C is a config instance available as a public config object.
@@ -91,6 +54,11 @@ type Config struct {
 	TranscodeWorkerNamespace string `mapstructure:"transcode_worker_namespace"`
 	TranscodeWorkerJobName   string `mapstructure:"transcode_worker_job_name"`
 	WorkerConcurrency        uint   `mapstructure:"worker_concurrency"`
+	Executor                 string `mapstructure:"executor"`
+	ExecutorConcurrency      uint   `mapstructure:"executor_concurrency"`
+	StageConcurrency         map[string]int `mapstructure:"stage_concurrency"`
+	WorkerTags               []string `mapstructure:"worker_tags"`
+	WorkerMaxResolution      string   `mapstructure:"worker_max_resolution"`
 	AWSRegion                string `mapstructure:"aws_region"`
 	AWSAccessKey             string `mapstructure:"aws_access_key"`
 	AWSSecretKey             string `mapstructure:"aws_secret_key"`
@@ -98,8 +66,34 @@ type Config struct {
 	S3InboundRegion          string `mapstructure:"s3_inbound_region"`
 	S3OutboundBucket         string `mapstructure:"s3_outbound_bucket"`
 	S3OutboundRegion         string `mapstructure:"s3_outbound_region"`
+	GCSBucket                string `mapstructure:"gcs_bucket"`
+	LogArchive               string `mapstructure:"log_archive"`
 	WorkDirectory            string `mapstructure:"work_dir"`
 	SlackWebhook             string `mapstructure:"slack_webhook"`
+	RetryMaxAttempts         int           `mapstructure:"retry_max_attempts"`
+	RetryBackoff             time.Duration `mapstructure:"retry_backoff"`
+	RetryMaxBackoff          time.Duration `mapstructure:"retry_max_backoff"`
+	PubsubProjectID          string `mapstructure:"pubsub_project_id"`
+	PubsubTopic              string `mapstructure:"pubsub_topic"`
+	PubsubSubscription       string `mapstructure:"pubsub_subscription"`
+	PubsubResultTopic        string `mapstructure:"pubsub_result_topic"`
+	IntakeSource             string `mapstructure:"intake_source"`
+	IntakeRedisStream        string `mapstructure:"intake_redis_stream"`
+	IntakeRedisGroup         string `mapstructure:"intake_redis_group"`
+	WebhookSecret            string        `mapstructure:"webhook_secret"`
+	WebhookMaxAttempts       int           `mapstructure:"webhook_max_attempts"`
+	WebhookBackoff           time.Duration `mapstructure:"webhook_backoff"`
+	WebhookTimeout           time.Duration `mapstructure:"webhook_timeout"`
+	WebhookPollInterval      time.Duration `mapstructure:"webhook_poll_interval"`
+	SchedulerInterval        time.Duration `mapstructure:"scheduler_interval"`
+	SchedulerMaxConcurrency  int           `mapstructure:"scheduler_max_concurrency"`
+	TenantMaxConcurrency     int           `mapstructure:"tenant_max_concurrency"`
+	LeaseDuration            time.Duration `mapstructure:"lease_duration"`
+	HeartbeatInterval        time.Duration `mapstructure:"heartbeat_interval"`
+	ReaperInterval           time.Duration `mapstructure:"reaper_interval"`
+	ShutdownGracePeriod      time.Duration `mapstructure:"shutdown_grace_period"`
+	Resources                resources     `mapstructure:"resources"`
+	ResourceEstimator        bool          `mapstructure:"resource_estimator"`
 	DigitalOceanAccessToken  string `mapstructure:"digitalocean_access_token"`
 
 	CloudinitRedisHost        string `mapstructure:"cloudinit_redis_host"`
@@ -110,23 +104,136 @@ type Config struct {
 	CloudinitDatabasePassword string `mapstructure:"cloudinit_database_password"`
 	CloudinitDatabaseName     string `mapstructure:"cloudinit_database_name"`
 
-	Profiles []profile
+	Kube      kubeConfig `mapstructure:"kube"`
+	NodePools []nodePool `mapstructure:"node_pools"`
+	Profiles  []profile
+	Tenants   []tenant
+	Schedules []schedule
+}
+
+// kubeConfig overrides the Kubernetes Job template transcode jobs ship in.
+// Node selectors, labels and annotations are key=value pairs; the affinity
+// is a YAML document of a pod affinity.
+type kubeConfig struct {
+	Template        string       `json:"template"`
+	Image           string       `json:"image"`
+	ImagePullPolicy string       `json:"image_pull_policy" mapstructure:"image_pull_policy"`
+	Namespace       string       `json:"namespace"`
+	ServiceAccount  string       `json:"service_account" mapstructure:"service_account"`
+	PVC             string       `json:"pvc"`
+	PVCMountPath    string       `json:"pvc_mount_path" mapstructure:"pvc_mount_path"`
+	CredentialsPath string       `json:"credentials_path" mapstructure:"credentials_path"`
+	NodeSelector    []string     `json:"node_selector" mapstructure:"node_selector"`
+	Tolerations     []Toleration `json:"tolerations"`
+	Affinity        string       `json:"affinity"`
+	Labels          []string     `json:"labels"`
+	Annotations     []string     `json:"annotations"`
+}
+
+// nodePool places the pods of jobs on a set of nodes. Profiles name the
+// pool they run in; jobs of profiles naming none run in the first pool
+// listing their priority.
+type nodePool struct {
+	Name         string       `json:"name"`
+	NodeSelector []string     `json:"node_selector" mapstructure:"node_selector"`
+	Tolerations  []Toleration `json:"tolerations"`
+	Affinity     string       `json:"affinity"`
+	Priorities   []string     `json:"priorities"`
+}
+
+// Toleration lets pods schedule onto nodes with a matching taint.
+type Toleration struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+	Effect   string `json:"effect"`
 }
 
 type profile struct {
-	Profile string   `json:"profile"`
-	Output  string   `json:"output"`
-	Publish bool     `json:"publish"`
-	Options []string `json:"options"`
+	Profile     string   `json:"profile"`
+	Output      string   `json:"output"`
+	Publish     bool     `json:"publish"`
+	Options     []string `json:"options"`
+	MaxAttempts int      `json:"max_attempts" mapstructure:"max_attempts"`
+	Resources   resources `json:"resources"`
+	NodePool    string    `json:"node_pool" mapstructure:"node_pool"`
+	Requires    requirements `json:"requires"`
 }
 
-// LoadConfig loads up the configuration struct.
+// requirements are what a profile needs of the worker running it: ffmpeg
+// encoders besides those its options name, the largest resolution, free
+// scratch space as a Kubernetes quantity, and worker tags.
+type requirements struct {
+	Encoders      []string `json:"encoders"`
+	MaxResolution string   `json:"max_resolution" mapstructure:"max_resolution"`
+	Scratch       string   `json:"scratch"`
+	Tags          []string `json:"tags"`
+}
+
+// resources describes the CPU and memory requested for and limiting a
+// transcode worker pod, as Kubernetes quantities.
+type resources struct {
+	CPURequest    string `json:"cpu_request" mapstructure:"cpu_request"`
+	CPULimit      string `json:"cpu_limit" mapstructure:"cpu_limit"`
+	MemoryRequest string `json:"memory_request" mapstructure:"memory_request"`
+	MemoryLimit   string `json:"memory_limit" mapstructure:"memory_limit"`
+}
+
+type tenant struct {
+	Tenant         string `json:"tenant"`
+	Weight         int    `json:"weight"`
+	MaxConcurrency int    `json:"max_concurrency" mapstructure:"max_concurrency"`
+}
+
+// schedule describes a recurring job run over every object under a storage
+// prefix, on a standard five-field cron spec.
+type schedule struct {
+	Name        string   `json:"name"`
+	Cron        string   `json:"cron"`
+	Source      string   `json:"source"`
+	Destination string   `json:"dest" mapstructure:"dest"`
+	Profiles    []string `json:"profiles"`
+	Action      string   `json:"action"`
+	Tenant      string   `json:"tenant"`
+	Priority    string   `json:"priority"`
+}
+
+// DefaultConfigName is the config name loaded when none is given. Unlike a
+// given config, it may be missing, leaving defaults and the environment.
+const DefaultConfigName = "default"
+
+// LoadConfig loads up the configuration struct. file is either a config name
+// looked up in the working and config directories, or a path to a YAML file.
 func LoadConfig(file string) {
 	viper.SetConfigType("yaml")
-	viper.SetConfigName(file)
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("config")
+	if strings.ContainsRune(file, '/') || strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml") {
+		viper.SetConfigFile(file)
+	} else {
+		viper.SetConfigName(file)
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("config")
+	}
+	viper.SetDefault("pubsub_topic", PubsubTopicID)
+	viper.SetDefault("pubsub_subscription", PubsubTopicSubscription)
+	viper.SetDefault("intake_source", "pubsub")
+	viper.SetDefault("retry_max_attempts", 3)
+	viper.SetDefault("retry_backoff", "5s")
+	viper.SetDefault("retry_max_backoff", "5m")
+	viper.SetDefault("scheduler_interval", "2s")
+	viper.SetDefault("webhook_poll_interval", "1s")
+	viper.SetDefault("executor", "kubernetes")
+	viper.SetDefault("lease_duration", "2m")
+	viper.SetDefault("heartbeat_interval", "30s")
+	viper.SetDefault("reaper_interval", "30s")
+	viper.SetDefault("shutdown_grace_period", "25s")
+	viper.SetDefault("resources.cpu_request", "750m")
+	viper.SetDefault("resources.cpu_limit", "750m")
+	viper.SetDefault("resources.memory_request", "2000M")
+	viper.SetDefault("resources.memory_limit", "2000M")
 	err := viper.ReadInConfig()
+	if _, notFound := err.(viper.ConfigFileNotFoundError); err != nil && !(notFound && file == DefaultConfigName) {
+		panic(fmt.Errorf("fatal error config file: %s", err))
+	}
 
 	viper.AutomaticEnv()
 	err = viper.Unmarshal(&C)
@@ -145,6 +252,113 @@ func GetFFmpegProfile(profile string) (t *profile, err error) {
 	return nil, errors.New("No task")
 }
 
+// GetSchedule finds a recurring schedule by name.
+func GetSchedule(name string) (*schedule, error) {
+	for _, v := range C.Schedules {
+		if v.Name == name {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown schedule %s", name)
+}
+
+// MaxAttempts returns how many times a stage of a job with the given
+// profile is attempted before the job is dead-lettered.
+func MaxAttempts(profile string) int {
+	if p, err := GetFFmpegProfile(profile); err == nil && p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	if C.RetryMaxAttempts > 0 {
+		return C.RetryMaxAttempts
+	}
+	return 1
+}
+
+// ProfileResources returns the pod resources of a profile, falling back to
+// the global resources for any the profile leaves unset.
+func ProfileResources(name string) resources {
+	r := C.Resources
+	p, err := GetFFmpegProfile(name)
+	if err != nil {
+		return r
+	}
+	if p.Resources.CPURequest != "" {
+		r.CPURequest = p.Resources.CPURequest
+	}
+	if p.Resources.CPULimit != "" {
+		r.CPULimit = p.Resources.CPULimit
+	}
+	if p.Resources.MemoryRequest != "" {
+		r.MemoryRequest = p.Resources.MemoryRequest
+	}
+	if p.Resources.MemoryLimit != "" {
+		r.MemoryLimit = p.Resources.MemoryLimit
+	}
+	return r
+}
+
+// JobNodePool returns the node pool of a job with the given profiles and
+// priority, or nil to run it wherever the template places it.
+func JobNodePool(profiles []string, priority string) *nodePool {
+	for _, name := range profiles {
+		p, err := GetFFmpegProfile(name)
+		if err != nil || p.NodePool == "" {
+			continue
+		}
+		if pool := GetNodePool(p.NodePool); pool != nil {
+			return pool
+		}
+	}
+	for i, pool := range C.NodePools {
+		for _, p := range pool.Priorities {
+			if p == priority {
+				return &C.NodePools[i]
+			}
+		}
+	}
+	return nil
+}
+
+// GetNodePool finds a node pool by name.
+func GetNodePool(name string) *nodePool {
+	for i, pool := range C.NodePools {
+		if pool.Name == name {
+			return &C.NodePools[i]
+		}
+	}
+	return nil
+}
+
+// GetStageConcurrency returns how many jobs a process runs a pipeline stage
+// of at once, or 0 for no limit.
+func GetStageConcurrency(stage string) int {
+	if n := C.StageConcurrency[stage]; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// TenantWeight returns the fair-share weight of a tenant.
+func TenantWeight(name string) int {
+	for _, t := range C.Tenants {
+		if t.Tenant == name && t.Weight > 0 {
+			return t.Weight
+		}
+	}
+	return 1
+}
+
+// TenantMaxConcurrency returns how many jobs of a tenant may run at once,
+// or 0 for no limit.
+func TenantMaxConcurrency(name string) int {
+	for _, t := range C.Tenants {
+		if t.Tenant == name && t.MaxConcurrency > 0 {
+			return t.MaxConcurrency
+		}
+	}
+	return C.TenantMaxConcurrency
+}
+
 // Get gets the current config.
 func Get() *Config {
 	return &C
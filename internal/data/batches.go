@@ -0,0 +1,117 @@
+package data
+
+import (
+	"fmt"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// GetBatches Gets batches with their job counts and progress, newest first.
+func GetBatches(offset, count int) (*[]models.Batch, error) {
+	const query = `SELECT * FROM batches ORDER BY id DESC LIMIT $1 OFFSET $2`
+
+	db, _ := ConnectDB()
+	batches := []models.Batch{}
+	err := db.Select(&batches, query, count, offset)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &batches, err
+	}
+	if err := summarizeBatches(db, batches); err != nil {
+		fmt.Println(err)
+	}
+	db.Close()
+	return &batches, nil
+}
+
+// GetBatchByID Gets a batch by ID with its job counts and progress.
+func GetBatchByID(id int) (*models.Batch, error) {
+	const query = `SELECT * FROM batches WHERE id = $1`
+
+	db, _ := ConnectDB()
+	b := models.Batch{}
+	err := db.Get(&b, query, id)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &b, err
+	}
+	batches := []models.Batch{b}
+	if err := summarizeBatches(db, batches); err != nil {
+		fmt.Println(err)
+	}
+	db.Close()
+	return &batches[0], nil
+}
+
+// GetJobsByBatchID Gets the jobs of a batch.
+func GetJobsByBatchID(id int64) (*[]models.Job, error) {
+	const query = `SELECT * FROM jobs WHERE batch_id = $1 ORDER BY id`
+
+	db, _ := ConnectDB()
+	jobs := []models.Job{}
+	err := db.Select(&jobs, query, id)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &jobs, err
+	}
+	db.Close()
+	return &jobs, nil
+}
+
+// summarizeBatches fills in the job counts and progress of batches in a
+// single query. Completed jobs count as fully done.
+func summarizeBatches(db *sqlx.DB, batches []models.Batch) error {
+	const query = `
+      SELECT
+        jobs.batch_id,
+        jobs.status,
+        COUNT(*) AS count,
+        SUM(CASE WHEN jobs.status = $2 THEN 100 ELSE COALESCE(transcode.progress, 0) END) AS progress
+      FROM jobs
+      LEFT JOIN transcode ON jobs.id = transcode.job_id
+      WHERE jobs.batch_id = ANY($1)
+      GROUP BY jobs.batch_id, jobs.status`
+
+	type statusCount struct {
+		BatchID  int64   `db:"batch_id"`
+		Status   string  `db:"status"`
+		Count    int     `db:"count"`
+		Progress float64 `db:"progress"`
+	}
+
+	if len(batches) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(batches))
+	for i, b := range batches {
+		ids[i] = b.ID
+	}
+
+	rows := []statusCount{}
+	if err := db.Select(&rows, query, pq.Array(ids), models.JobCompleted); err != nil {
+		return err
+	}
+
+	counts := map[int64]map[string]int{}
+	progress := map[int64]float64{}
+	for _, r := range rows {
+		if counts[r.BatchID] == nil {
+			counts[r.BatchID] = map[string]int{}
+		}
+		counts[r.BatchID][r.Status] = r.Count
+		progress[r.BatchID] += r.Progress
+	}
+	for i := range batches {
+		c := counts[batches[i].ID]
+		if c == nil {
+			c = map[string]int{}
+		}
+		batches[i].Summarize(c, progress[batches[i].ID])
+	}
+	return nil
+}
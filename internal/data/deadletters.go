@@ -0,0 +1,97 @@
+package data
+
+import (
+	"fmt"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+// CreateDeadLetter adds a job to the dead-letter list.
+func CreateDeadLetter(dl models.DeadLetter) (*models.DeadLetter, error) {
+	const query = `
+      INSERT INTO
+        dead_letters (job_id,stage,error,attempts)
+      VALUES (:job_id,:stage,:error,:attempts)
+      RETURNING id`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	stmt, err := tx.PrepareNamed(query)
+	if err != nil {
+		fmt.Println("Error", err.Error())
+		tx.Rollback()
+		db.Close()
+		return &dl, err
+	}
+
+	var id int64 // Returned ID.
+	err = stmt.QueryRowx(&dl).Scan(&id)
+	if err != nil {
+		fmt.Println("Error", err.Error())
+		tx.Rollback()
+		db.Close()
+		return &dl, err
+	}
+	tx.Commit()
+
+	dl.ID = id
+
+	db.Close()
+	return &dl, nil
+}
+
+// GetDeadLetters Gets dead-lettered jobs, newest first. Replayed entries are
+// only included when all is set.
+func GetDeadLetters(all bool, offset, count int) (*[]models.DeadLetter, error) {
+	const query = `
+      SELECT * FROM dead_letters
+      WHERE $1 OR replayed_date IS NULL
+      ORDER BY id DESC
+      LIMIT $2 OFFSET $3`
+
+	db, _ := ConnectDB()
+	dls := []models.DeadLetter{}
+	err := db.Select(&dls, query, all, count, offset)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &dls, err
+	}
+	db.Close()
+	return &dls, nil
+}
+
+// GetDeadLetterByID Gets a dead letter by ID.
+func GetDeadLetterByID(id int) (*models.DeadLetter, error) {
+	const query = `SELECT * FROM dead_letters WHERE id = $1`
+
+	db, _ := ConnectDB()
+	dl := models.DeadLetter{}
+	err := db.Get(&dl, query, id)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &dl, err
+	}
+	db.Close()
+	return &dl, nil
+}
+
+// MarkDeadLetterReplayed records that a dead letter was replayed.
+func MarkDeadLetterReplayed(id int64) error {
+	const query = `UPDATE dead_letters SET replayed_date = CURRENT_TIMESTAMP WHERE id = $1`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.Exec(query, id)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
@@ -0,0 +1,60 @@
+package data
+
+import (
+	"fmt"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const insertJobEventQuery = `
+      INSERT INTO
+        job_events (job_id,status,worker,message)
+      SELECT id, $2, $3, $4 FROM jobs WHERE guid = $1`
+
+// createJobEventTx records a status transition inside an existing transaction.
+func createJobEventTx(tx *sqlx.Tx, guid, status, worker, message string) error {
+	_, err := tx.Exec(insertJobEventQuery, guid, status, worker, message)
+	return err
+}
+
+// GetJobEventsByJobID Gets the event history of a job, oldest first.
+func GetJobEventsByJobID(id int) (*[]models.JobEvent, error) {
+	const query = `
+      SELECT id, job_id, status, worker, message, created_date
+      FROM job_events
+      WHERE job_id = $1
+      ORDER BY created_date ASC, id ASC`
+
+	db, _ := ConnectDB()
+	events := []models.JobEvent{}
+	err := db.Select(&events, query, id)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &events, err
+	}
+	db.Close()
+	return &events, nil
+}
+
+// GetLastJobEventID Gets the ID of the latest event of a job by GUID, which
+// grows with every status transition of the job, whichever process makes it.
+func GetLastJobEventID(guid string) (int64, error) {
+	const query = `
+      SELECT COALESCE(MAX(job_events.id), 0)
+      FROM job_events
+      JOIN jobs ON jobs.id = job_events.job_id
+      WHERE jobs.guid = $1`
+
+	db, _ := ConnectDB()
+	var eventID int64
+	err := db.Get(&eventID, query, guid)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return 0, err
+	}
+	db.Close()
+	return eventID, nil
+}
@@ -0,0 +1,231 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrCursorMismatch is returned when a pagination cursor was issued for a
+// different sort order than the search it is used with.
+var ErrCursorMismatch = errors.New("cursor does not match the sort order")
+
+// ErrInvalidSort is returned when a jobs search sorts by an unknown field.
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// JobSortFields maps the sortable fields of a jobs search to their columns.
+var JobSortFields = map[string]string{
+	"id":           "jobs.id",
+	"created_date": "jobs.created_date",
+	"status":       "COALESCE(jobs.status, '')",
+	"profile":      "jobs.profile",
+	"action":       "jobs.action",
+	"c24_job_id":   "jobs.c24_job_id",
+}
+
+// JobFilter describes the filters, sort order and page of a jobs search.
+type JobFilter struct {
+	Statuses      []string
+	Profile       string
+	Action        string
+	C24JobID      string
+	Tenant        string
+	BatchID       int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Meta          map[string]string
+
+	Sort   string
+	Desc   bool
+	Cursor string
+	Offset int
+	Limit  int
+}
+
+// jobCursor is the position of the last job of a page, in the sort order
+// it was issued for.
+type jobCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// SearchJobs Gets the jobs matching a filter, along with the cursor of the
+// next page. The cursor is empty on the last page.
+func SearchJobs(f JobFilter) (*[]models.Job, string, error) {
+	jobs := []models.Job{}
+
+	column, ok := JobSortFields[f.sortField()]
+	if !ok {
+		return &jobs, "", ErrInvalidSort
+	}
+	direction, op := "ASC", ">"
+	if f.Desc {
+		direction, op = "DESC", "<"
+	}
+
+	conds, args := f.conditions()
+	if f.Cursor != "" {
+		c, err := decodeJobCursor(f.Cursor)
+		if err != nil {
+			return &jobs, "", err
+		}
+		if c.Sort != f.sortField() || c.Desc != f.Desc {
+			return &jobs, "", ErrCursorMismatch
+		}
+		args = append(args, c.Value, c.ID)
+		conds = append(conds, fmt.Sprintf("(%s, jobs.id) %s ($%d, $%d)", column, op, len(args)-1, len(args)))
+	}
+
+	args = append(args, f.Limit)
+	limit := len(args)
+	offset := ""
+	if f.Cursor == "" && f.Offset > 0 {
+		args = append(args, f.Offset)
+		offset = fmt.Sprintf("OFFSET $%d", len(args))
+	}
+
+	query := fmt.Sprintf(`
+      SELECT
+        jobs.*,
+        transcode.id "transcode.id",
+        transcode.data "transcode.data",
+        transcode.progress "transcode.progress"
+      FROM jobs
+      LEFT JOIN transcode ON jobs.id = transcode.job_id
+      %s
+      ORDER BY %s %s, jobs.id %s
+      LIMIT $%d %s`, whereClause(conds), column, direction, direction, limit, offset)
+
+	db, _ := ConnectDB()
+	err := db.Select(&jobs, query, args...)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &jobs, "", err
+	}
+	if err = attachJobOutputs(db, jobs); err != nil {
+		fmt.Println(err)
+	}
+	db.Close()
+
+	next := ""
+	if f.Limit > 0 && len(jobs) == f.Limit {
+		next = encodeJobCursor(f.sortField(), f.Desc, jobs[len(jobs)-1])
+	}
+	return &jobs, next, nil
+}
+
+// CountJobs Gets a count of the jobs matching a filter.
+func CountJobs(f JobFilter) (int, error) {
+	var count int
+	conds, args := f.conditions()
+	query := "SELECT COUNT(*) FROM jobs " + whereClause(conds)
+
+	db, _ := ConnectDB()
+	err := db.Get(&count, query, args...)
+	if err != nil {
+		fmt.Println(err)
+	}
+	db.Close()
+	return count, err
+}
+
+func (f JobFilter) sortField() string {
+	if f.Sort == "" {
+		return "id"
+	}
+	return f.Sort
+}
+
+// conditions builds the WHERE conditions and arguments of a filter.
+func (f JobFilter) conditions() ([]string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), -1))
+	}
+
+	if len(f.Statuses) > 0 {
+		add("jobs.status = ANY(?)", pq.Array(f.Statuses))
+	}
+	if f.Profile != "" {
+		add("(jobs.profile = ? OR EXISTS "+
+			"(SELECT 1 FROM job_outputs WHERE job_outputs.job_id = jobs.id AND job_outputs.profile = ?))", f.Profile)
+	}
+	if f.Action != "" {
+		add("jobs.action = ?", f.Action)
+	}
+	if f.C24JobID != "" {
+		add("jobs.c24_job_id = ?", f.C24JobID)
+	}
+	if f.Tenant != "" {
+		add("jobs.tenant = ?", f.Tenant)
+	}
+	if f.BatchID != 0 {
+		add("jobs.batch_id = ?", f.BatchID)
+	}
+	if f.CreatedAfter != nil {
+		add("jobs.created_date >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		add("jobs.created_date < ?", *f.CreatedBefore)
+	}
+	if len(f.Meta) > 0 {
+		b, _ := json.Marshal(f.Meta)
+		add("jobs.metadata @> ?::jsonb", string(b))
+	}
+	return conds, args
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conds, " AND ")
+}
+
+func encodeJobCursor(sort string, desc bool, job models.Job) string {
+	c := jobCursor{Sort: sort, Desc: desc, ID: job.ID}
+	switch sort {
+	case "id":
+		c.Value = strconv.FormatInt(job.ID, 10)
+	case "created_date":
+		c.Value = job.CreatedDate
+	case "status":
+		c.Value = job.Status
+	case "profile":
+		c.Value = job.Profile
+	case "action":
+		c.Value = job.Action
+	case "c24_job_id":
+		c.Value = job.C24JobID
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJobCursor(cursor string) (*jobCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &jobCursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
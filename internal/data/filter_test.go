@@ -0,0 +1,70 @@
+package data
+
+import (
+	"testing"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+func TestJobCursorRoundTrip(t *testing.T) {
+	job := models.Job{
+		ID:          42,
+		CreatedDate: "2019-10-01T12:00:00Z",
+		Status:      models.JobCompleted,
+		Profile:     "baseline_mp4",
+		Action:      "transcode",
+		C24JobID:    "c24-1",
+	}
+	tests := []struct {
+		sort  string
+		desc  bool
+		value string
+	}{
+		{"id", false, "42"},
+		{"id", true, "42"},
+		{"created_date", true, "2019-10-01T12:00:00Z"},
+		{"status", false, models.JobCompleted},
+		{"profile", true, "baseline_mp4"},
+		{"action", false, "transcode"},
+		{"c24_job_id", true, "c24-1"},
+	}
+	for _, tt := range tests {
+		c, err := decodeJobCursor(encodeJobCursor(tt.sort, tt.desc, job))
+		if err != nil {
+			t.Errorf("%s desc=%v: %v", tt.sort, tt.desc, err)
+			continue
+		}
+		want := jobCursor{Sort: tt.sort, Desc: tt.desc, Value: tt.value, ID: 42}
+		if *c != want {
+			t.Errorf("%s desc=%v: cursor = %+v, want %+v", tt.sort, tt.desc, *c, want)
+		}
+	}
+}
+
+func TestDecodeJobCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"%%%", "bm90IGpzb24"} {
+		if _, err := decodeJobCursor(cursor); err != ErrInvalidCursor {
+			t.Errorf("decodeJobCursor(%q) error = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestJobFilterSortField(t *testing.T) {
+	if got := (JobFilter{}).sortField(); got != "id" {
+		t.Errorf("default sort = %q, want id", got)
+	}
+	if got := (JobFilter{Sort: "status"}).sortField(); got != "status" {
+		t.Errorf("sort = %q, want status", got)
+	}
+}
+
+func TestJobFilterConditions(t *testing.T) {
+	f := JobFilter{Statuses: []string{models.JobError}, Action: "transcode", Tenant: "c24"}
+	conds, args := f.conditions()
+	if len(conds) != 3 || len(args) != 3 {
+		t.Fatalf("conditions = %q with %d args, want 3 of each", conds, len(args))
+	}
+	if conds[1] != "jobs.action = $2" {
+		t.Errorf("action condition = %q, want %q", conds[1], "jobs.action = $2")
+	}
+}
@@ -1,8 +1,12 @@
 package data
 
 import (
+	"errors"
 	"fmt"
+	"github.com/harisbeha/media-transcoder/internal/helpers"
 	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // GetJobs Gets all jobs.
@@ -24,6 +28,9 @@ func GetJobs(offset, count int) *[]models.Job {
 	if err != nil {
 		fmt.Println(err)
 	}
+	if err = attachJobOutputs(db, jobs); err != nil {
+		fmt.Println(err)
+	}
 	db.Close()
 	return &jobs
 }
@@ -47,6 +54,9 @@ func GetJobByID(id int) (*models.Job, error) {
 		fmt.Println(err)
 		return &job, err
 	}
+	if job.Outputs, err = selectJobOutputs(db, job.ID); err != nil {
+		fmt.Println(err)
+	}
 	db.Close()
 	return &job, nil
 }
@@ -70,6 +80,9 @@ func GetJobByGUID(id string) (*models.Job, error) {
 		fmt.Println(err)
 		return &job, err
 	}
+	if job.Outputs, err = selectJobOutputs(db, job.ID); err != nil {
+		fmt.Println(err)
+	}
 	db.Close()
 	return &job, nil
 }
@@ -124,73 +137,99 @@ func GetJobsStats() (*[]Stats, error) {
 	return &resp, nil
 }
 
-// CreateJob creates a job in database.
-func CreateJob(job models.Job) *models.Job {
-	const query = `
-      INSERT INTO
-        jobs (guid,profile,status,c24_job_id,action,source,destination)
-      VALUES (:guid,:profile,:status,:c24_job_id,:action,:source,:destination)
-      RETURNING id`
+// UpdateEncodeDataByID Update transcode by ID.
+func UpdateEncodeDataByID(id int64, jsonString string) error {
+	const query = `UPDATE transcode SET data = $1 WHERE id = $2`
 
 	db, _ := ConnectDB()
 	tx := db.MustBegin()
-	stmt, err := tx.PrepareNamed(query)
+	_, err := tx.Exec(query, jsonString, id)
 	if err != nil {
-		fmt.Println("Error", err.Error())
+		fmt.Println(err)
+		return err
 	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
 
-	var id int64 // Returned ID.
-	err = stmt.QueryRowx(&job).Scan(&id)
+// UpdateEncodeProgressByID Update progress by ID.
+func UpdateEncodeProgressByID(id int64, progress float64) error {
+	const query = `UPDATE transcode SET progress = $1 WHERE id = $2`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.Exec(query, progress, id)
 	if err != nil {
-		fmt.Println("Error", err.Error())
+		fmt.Println(err)
+		return err
 	}
 	tx.Commit()
 
-	// Set to Job type response.
-	job.ID = id
-
 	db.Close()
-	return &job
+	return nil
 }
 
-// CreateEncodeData creates transcode in database.
-func CreateEncodeData(ed models.EncodeData) *models.EncodeData {
-	const query = `
-      INSERT INTO
-        transcode (data,progress,job_id)
-      VALUES (:data,:progress,:job_id)
-      RETURNING id`
+// ErrInvalidTransition is returned when a job cannot move to the requested
+// status from the status it currently holds.
+var ErrInvalidTransition = errors.New("invalid job status transition")
+
+// UpdateJobByID Update job by ID, moving it from the given status only.
+func UpdateJobByID(id int, from string, job models.Job) (*models.Job, error) {
+	const query = `UPDATE jobs SET status = $1 WHERE id = $2 AND status = $3`
+
+	if !models.CanTransition(from, job.Status) {
+		return &job, ErrInvalidTransition
+	}
 
 	db, _ := ConnectDB()
 	tx := db.MustBegin()
-	stmt, err := tx.PrepareNamed(query)
+	err := compareAndSetStatus(tx, query, job.Status, id, from)
 	if err != nil {
-		fmt.Println("Error", err.Error())
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return &job, err
 	}
-
-	var id int64 // Returned ID.
-	err = stmt.QueryRowx(&ed).Scan(&id)
+	err = createJobEventTx(tx, job.GUID, job.Status, "api", "status updated via API")
 	if err != nil {
-		fmt.Println("Error", err.Error())
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return &job, err
 	}
 	tx.Commit()
 
-	// Set to Job type response.
-	ed.EncodeDataID = id
-
 	db.Close()
-	return &ed
+	return &job, nil
 }
 
-// UpdateEncodeDataByID Update transcode by ID.
-func UpdateEncodeDataByID(id int64, jsonString string) error {
-	const query = `UPDATE transcode SET data = $1 WHERE id = $2`
+// UpdateJobStatus Update job status by ID.
+func UpdateJobStatus(guid string, status string) error {
+	return UpdateJobStatusWithMessage(guid, status, "")
+}
+
+// UpdateJobStatusWithMessage Update job status by GUID and record the
+// transition in the job's event history. The update only applies when the
+// job's current status may transition to the new one.
+func UpdateJobStatusWithMessage(guid string, status string, message string) error {
+	const query = `UPDATE jobs SET status = $1 WHERE guid = $2 AND status = ANY($3)`
 
 	db, _ := ConnectDB()
 	tx := db.MustBegin()
-	_, err := tx.Exec(query, jsonString, id)
+	err := compareAndSetStatus(tx, query, status, guid, pq.Array(models.TransitionSources(status)))
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	err = createJobEventTx(tx, guid, status, helpers.WorkerID(), message)
 	if err != nil {
 		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
 		return err
 	}
 	tx.Commit()
@@ -199,15 +238,35 @@ func UpdateEncodeDataByID(id int64, jsonString string) error {
 	return nil
 }
 
-// UpdateEncodeProgressByID Update progress by ID.
-func UpdateEncodeProgressByID(id int64, progress float64) error {
-	const query = `UPDATE transcode SET progress = $1 WHERE id = $2`
+// UpdateJobStatusFrom Update job status by GUID, moving it only from one of
+// the given statuses, and record the transition in the job's event history.
+func UpdateJobStatusFrom(guid string, from []string, status string, message string) error {
+	const query = `UPDATE jobs SET status = $1 WHERE guid = $2 AND status = ANY($3)`
+
+	sources := []string{}
+	for _, f := range from {
+		if models.CanTransition(f, status) {
+			sources = append(sources, f)
+		}
+	}
+	if len(sources) == 0 {
+		return ErrInvalidTransition
+	}
 
 	db, _ := ConnectDB()
 	tx := db.MustBegin()
-	_, err := tx.Exec(query, progress, id)
+	err := compareAndSetStatus(tx, query, status, guid, pq.Array(sources))
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	err = createJobEventTx(tx, guid, status, helpers.WorkerID(), message)
 	if err != nil {
 		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
 		return err
 	}
 	tx.Commit()
@@ -216,35 +275,80 @@ func UpdateEncodeProgressByID(id int64, progress float64) error {
 	return nil
 }
 
-// UpdateJobByID Update job by ID.
-func UpdateJobByID(id int, job models.Job) *models.Job {
-	const query = `UPDATE jobs SET status = :status WHERE id = :id`
+// compareAndSetStatus runs a conditional status update and reports
+// ErrInvalidTransition when no row matched the expected status.
+func compareAndSetStatus(tx *sqlx.Tx, query string, args ...interface{}) error {
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidTransition
+	}
+	return nil
+}
+
+// GetJobStatus Gets the current status of a job by GUID.
+func GetJobStatus(guid string) (string, error) {
+	const query = `SELECT status FROM jobs WHERE guid = $1`
 
 	db, _ := ConnectDB()
-	tx := db.MustBegin()
-	_, err := tx.NamedExec(query, &job)
+	var status string
+	err := db.Get(&status, query, guid)
 	if err != nil {
 		fmt.Println(err)
+		db.Close()
+		return status, err
+	}
+	db.Close()
+	return status, nil
+}
+
+// DeleteJob Delete a job by ID along with its transcode data. Events,
+// outputs, webhook deliveries and dead letters are removed by cascade.
+func DeleteJob(id int64) error {
+	const deleteTranscode = `DELETE FROM transcode WHERE job_id = $1`
+	const deleteJob = `DELETE FROM jobs WHERE id = $1`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	if _, err := tx.Exec(deleteTranscode, id); err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	if _, err := tx.Exec(deleteJob, id); err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
 	}
 	tx.Commit()
 
 	db.Close()
-	return &job
+	return nil
 }
 
-// UpdateJobStatus Update job status by ID.
-func UpdateJobStatus(guid string, status string) error {
-	const query = `UPDATE jobs SET status = $1 WHERE guid = $2`
+// SetJobPodName Records the Kubernetes pod running a job.
+func SetJobPodName(guid string, pod string) error {
+	const query = `UPDATE jobs SET pod_name = $1 WHERE guid = $2`
 
 	db, _ := ConnectDB()
 	tx := db.MustBegin()
-	_, err := tx.Exec(query, status, guid)
+	_, err := tx.Exec(query, pod, guid)
 	if err != nil {
 		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
 		return err
 	}
 	tx.Commit()
 
 	db.Close()
 	return nil
-}
\ No newline at end of file
+}
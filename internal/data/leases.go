@@ -0,0 +1,152 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/lib/pq"
+)
+
+// AcquireLease Takes the lease on a job for a worker, replacing any lease
+// left by an earlier worker.
+func AcquireLease(guid, leaseID, owner, stage string, ttl time.Duration) error {
+	const query = `
+      UPDATE jobs SET
+        lease_id = $1,
+        lease_owner = $2,
+        lease_stage = $3,
+        lease_progress = 0,
+        heartbeat_date = now(),
+        lease_expires = now() + $4 * interval '1 second'
+      WHERE guid = $5`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.Exec(query, leaseID, owner, stage, ttl.Seconds(), guid)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
+
+// RenewLease Records a heartbeat of the worker holding a job's lease and
+// extends the lease. It reports false when the lease was taken from the
+// worker, e.g. by the reaper.
+func RenewLease(guid, leaseID, stage string, progress float64, ttl time.Duration) (bool, error) {
+	const query = `
+      UPDATE jobs SET
+        lease_stage = $1,
+        lease_progress = $2,
+        heartbeat_date = now(),
+        lease_expires = now() + $3 * interval '1 second'
+      WHERE guid = $4 AND lease_id = $5`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	err := compareAndSetStatus(tx, query, stage, progress, ttl.Seconds(), guid, leaseID)
+	if err == ErrInvalidTransition {
+		tx.Rollback()
+		db.Close()
+		return false, nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return false, err
+	}
+	tx.Commit()
+
+	db.Close()
+	return true, nil
+}
+
+// ReleaseLease Gives up a worker's lease on a job once it stops running it.
+func ReleaseLease(guid, leaseID string) error {
+	const query = `
+      UPDATE jobs SET lease_id = NULL, lease_expires = NULL
+      WHERE guid = $1 AND lease_id = $2`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.Exec(query, guid, leaseID)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
+
+// GetExpiredLeases Gets the running jobs whose worker stopped renewing its
+// lease.
+func GetExpiredLeases() (*[]models.Job, error) {
+	const query = `
+      SELECT * FROM jobs
+      WHERE lease_id IS NOT NULL
+        AND lease_expires < now()
+        AND status = ANY($1)
+      ORDER BY lease_expires`
+
+	running := []string{
+		models.JobDownloading,
+		models.JobDownloaded,
+		models.JobProbing,
+		models.JobEncoding,
+		models.JobUploading,
+		models.JobRetrying,
+	}
+
+	db, _ := ConnectDB()
+	jobs := []models.Job{}
+	err := db.Select(&jobs, query, pq.Array(running))
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return nil, err
+	}
+	db.Close()
+	return &jobs, nil
+}
+
+// ReapLease Takes an expired lease from a job, counting the job as reaped.
+// It reports false when the worker renewed the lease or another reaper got
+// to it first.
+func ReapLease(id int64, leaseID string) (bool, error) {
+	const query = `
+      UPDATE jobs SET
+        lease_id = NULL,
+        lease_expires = NULL,
+        reaped_count = reaped_count + 1
+      WHERE id = $1 AND lease_id = $2 AND lease_expires < now()`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	err := compareAndSetStatus(tx, query, id, leaseID)
+	if err == ErrInvalidTransition {
+		tx.Rollback()
+		db.Close()
+		return false, nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return false, err
+	}
+	tx.Commit()
+
+	db.Close()
+	return true, nil
+}
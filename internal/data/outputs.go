@@ -0,0 +1,106 @@
+package data
+
+import (
+	"fmt"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// GetJobOutputsByJobID Gets the outputs of a job.
+func GetJobOutputsByJobID(id int64) (*[]models.JobOutput, error) {
+	db, _ := ConnectDB()
+	outputs, err := selectJobOutputs(db, id)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &outputs, err
+	}
+	db.Close()
+	return &outputs, nil
+}
+
+func selectJobOutputs(db *sqlx.DB, id int64) ([]models.JobOutput, error) {
+	const query = `
+      SELECT * FROM job_outputs
+      WHERE job_id = $1
+      ORDER BY id ASC`
+
+	outputs := []models.JobOutput{}
+	err := db.Select(&outputs, query, id)
+	return outputs, err
+}
+
+// attachJobOutputs loads the outputs of every job in one query.
+func attachJobOutputs(db *sqlx.DB, jobs []models.Job) error {
+	const query = `
+      SELECT * FROM job_outputs
+      WHERE job_id = ANY($1)
+      ORDER BY id ASC`
+
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(jobs))
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+
+	outputs := []models.JobOutput{}
+	if err := db.Select(&outputs, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	byJob := map[int64][]models.JobOutput{}
+	for _, o := range outputs {
+		byJob[o.JobID] = append(byJob[o.JobID], o)
+	}
+	for i := range jobs {
+		jobs[i].Outputs = byJob[jobs[i].ID]
+	}
+	return nil
+}
+
+// UpdateJobOutputStatus Update output status by ID.
+func UpdateJobOutputStatus(id int64, status string) error {
+	const query = `UPDATE job_outputs SET status = $1 WHERE id = $2`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.Exec(query, status, id)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
+
+// UpdateJobOutput Update the result fields of an output by ID.
+func UpdateJobOutput(output models.JobOutput) error {
+	const query = `
+      UPDATE job_outputs
+      SET url = :url, size = :size, duration = :duration, bitrate = :bitrate,
+        checksum = :checksum, status = :status
+      WHERE id = :id`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.NamedExec(query, &output)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
@@ -0,0 +1,207 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrStaleDispatch is returned when a job handed back to the dispatcher was
+// released again, or handed back, since the caller read it.
+var ErrStaleDispatch = errors.New("job dispatch changed since it was read")
+
+// activeStatuses are the statuses of a released job that still holds one
+// of its tenant's slots.
+var activeStatuses = []string{
+	models.JobQueued,
+	models.JobDownloading,
+	models.JobDownloaded,
+	models.JobProbing,
+	models.JobEncoding,
+	models.JobUploading,
+	models.JobRetrying,
+}
+
+// GetPendingJobs Gets the jobs due by the given time that wait to be
+// released to a work queue, with their encode data, at most perTenant per
+// tenant, each tenant's jobs highest priority first.
+func GetPendingJobs(perTenant int, due time.Time) (*[]models.Job, error) {
+	const query = `
+      SELECT * FROM (
+        SELECT
+          jobs.*,
+          transcode.id "transcode.id",
+          transcode.data "transcode.data",
+          transcode.progress "transcode.progress",
+          ROW_NUMBER() OVER (
+            PARTITION BY jobs.tenant
+            ORDER BY array_position($1::text[], jobs.priority::text), jobs.created_date, jobs.id
+          ) AS tenant_rank
+        FROM jobs
+        LEFT JOIN transcode ON jobs.id = transcode.job_id
+        WHERE jobs.dispatched_date IS NULL
+          AND jobs.status = ANY($2)
+          AND jobs.action <> 'snippetize'
+          AND (jobs.run_at IS NULL OR jobs.run_at <= $4)
+      ) pending
+      WHERE pending.tenant_rank <= $3
+      ORDER BY pending.tenant, pending.tenant_rank`
+
+	type pendingJob struct {
+		models.Job
+		TenantRank int `db:"tenant_rank"`
+	}
+
+	db, _ := ConnectDB()
+	rows := []pendingJob{}
+	statuses := []string{models.JobQueued, models.JobRetrying}
+	err := db.Select(&rows, query, pq.Array(models.Priorities), pq.Array(statuses), perTenant, due)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return nil, err
+	}
+	db.Close()
+
+	jobs := make([]models.Job, len(rows))
+	for i, r := range rows {
+		jobs[i] = r.Job
+	}
+	return &jobs, nil
+}
+
+// GetRunningCounts Gets the number of released, unfinished jobs per tenant.
+func GetRunningCounts() (map[string]int, error) {
+	const query = `
+      SELECT tenant, COUNT(*) AS count
+      FROM jobs
+      WHERE dispatched_date IS NOT NULL AND status = ANY($1)
+      GROUP BY tenant`
+
+	type tenantCount struct {
+		Tenant string `db:"tenant"`
+		Count  int    `db:"count"`
+	}
+
+	db, _ := ConnectDB()
+	rows := []tenantCount{}
+	err := db.Select(&rows, query, pq.Array(activeStatuses))
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return nil, err
+	}
+	db.Close()
+
+	counts := map[string]int{}
+	for _, r := range rows {
+		counts[r.Tenant] = r.Count
+	}
+	return counts, nil
+}
+
+// GetRunningJobs Gets the released, unfinished jobs with their outputs.
+func GetRunningJobs() (*[]models.Job, error) {
+	const query = `
+      SELECT * FROM jobs
+      WHERE dispatched_date IS NOT NULL AND status = ANY($1)
+      ORDER BY id`
+
+	db, _ := ConnectDB()
+	jobs := []models.Job{}
+	err := db.Select(&jobs, query, pq.Array(activeStatuses))
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return nil, err
+	}
+	if err = attachJobOutputs(db, jobs); err != nil {
+		fmt.Println(err)
+	}
+	db.Close()
+	return &jobs, nil
+}
+
+// MarkJobDispatched Records that a job was released to its work queue, and
+// the time it was on the job. It reports false when another dispatcher
+// released the job first.
+func MarkJobDispatched(job *models.Job) (bool, error) {
+	const query = `
+      UPDATE jobs SET dispatched_date = now()
+      WHERE id = $1 AND dispatched_date IS NULL
+      RETURNING dispatched_date`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	var dispatched models.NullString
+	err := tx.Get(&dispatched, query, job.ID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		db.Close()
+		return false, nil
+	}
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return false, err
+	}
+	tx.Commit()
+
+	db.Close()
+	job.DispatchedDate = dispatched
+	return true, nil
+}
+
+// MarkJobPending Hands a job back to the dispatcher to be released again,
+// running from the given pipeline stage. Only the dispatch the caller holds
+// is handed back: the update applies when the job's dispatched date still
+// is the one given, and reports ErrStaleDispatch otherwise.
+func MarkJobPending(guid, stage string, dispatched models.NullString) error {
+	const query = `
+      UPDATE jobs SET dispatched_date = NULL, dispatch_stage = $1
+      WHERE guid = $2 AND dispatched_date IS NOT DISTINCT FROM $3::timestamp`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	err := compareAndSetStatus(tx, query, stage, guid, dispatched)
+	if err == ErrInvalidTransition {
+		err = ErrStaleDispatch
+	}
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
+
+// GetLastScheduledRun Gets when a recurring schedule last created a job.
+func GetLastScheduledRun(schedule string) (*time.Time, error) {
+	const query = `SELECT MAX(created_date) FROM jobs WHERE metadata @> $1`
+
+	b, err := json.Marshal(models.JobMetadata{"schedule": schedule})
+	if err != nil {
+		return nil, err
+	}
+
+	db, _ := ConnectDB()
+	var last *time.Time
+	err = db.Get(&last, query, string(b))
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return nil, err
+	}
+	db.Close()
+	return last, nil
+}
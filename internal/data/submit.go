@@ -0,0 +1,194 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/harisbeha/media-transcoder/internal/helpers"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	submitJobQuery = `
+      INSERT INTO
+        jobs (guid,profile,status,c24_job_id,action,source,destination,metadata,callback,idempotency_key,tenant,priority,run_at,batch_id)
+      VALUES (:guid,:profile,:status,:c24_job_id,:action,:source,:destination,:metadata,:callback,:idempotency_key,:tenant,:priority,:run_at,:batch_id)
+      ON CONFLICT (idempotency_key) WHERE idempotency_key <> '' DO NOTHING
+      RETURNING id`
+	submitOutputQuery = `
+      INSERT INTO
+        job_outputs (job_id,profile,url,size,duration,bitrate,checksum,status)
+      VALUES (:job_id,:profile,:url,:size,:duration,:bitrate,:checksum,:status)
+      RETURNING id`
+	submitEncodeQuery = `
+      INSERT INTO
+        transcode (data,progress,job_id)
+      VALUES ('{}',0,$1)
+      RETURNING id`
+)
+
+// SubmitJob records a new job together with its outputs, encode data and
+// first event in a single transaction. When a job with the same idempotency
+// key already exists, that job is returned instead and created is false.
+func SubmitJob(job models.Job, outputs []models.JobOutput) (j *models.Job, created bool, err error) {
+	db, err := ConnectDB()
+	if err != nil {
+		return nil, false, err
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	created, err = submitJobTx(tx, &job, outputs)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created {
+		// Duplicate submission; hand back the job already recorded.
+		tx.Rollback()
+		existing, getErr := GetJobByIdempotencyKey(job.IdempotencyKey)
+		return existing, false, getErr
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return &job, true, nil
+}
+
+// SubmitBatch records a batch and all of its jobs, with their outputs,
+// encode data and first events, in a single transaction: either every job
+// is recorded or none is. Jobs whose idempotency key is already taken are
+// skipped and reported as duplicates.
+func SubmitBatch(b models.Batch, jobs []models.Job, outputs [][]models.JobOutput) (batch *models.Batch, submitted, duplicates int, err error) {
+	const batchQuery = `
+      INSERT INTO
+        batches (guid,name,tenant)
+      VALUES (:guid,:name,:tenant)
+      RETURNING id, created_date`
+
+	db, err := ConnectDB()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareNamed(batchQuery)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if err = stmt.QueryRowx(&b).Scan(&b.ID, &b.CreatedDate); err != nil {
+		return nil, 0, 0, err
+	}
+
+	for i := range jobs {
+		jobs[i].BatchID = &b.ID
+		created, err := submitJobTx(tx, &jobs[i], outputs[i])
+		if err != nil {
+			tx.Rollback()
+			return nil, 0, 0, fmt.Errorf("jobs[%d]: %v", i, err)
+		}
+		if created {
+			submitted++
+		} else {
+			duplicates++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, 0, 0, err
+	}
+	return &b, submitted, duplicates, nil
+}
+
+// submitJobTx records a new job and its outputs, encode data and first
+// event within tx, filling in the job's IDs. It reports false, recording
+// nothing, when the job's idempotency key is already taken.
+func submitJobTx(tx *sqlx.Tx, job *models.Job, outputs []models.JobOutput) (bool, error) {
+	if job.Priority == "" {
+		job.Priority = models.PriorityNormal
+	}
+
+	stmt, err := tx.PrepareNamed(submitJobQuery)
+	if err != nil {
+		return false, err
+	}
+	err = stmt.QueryRowx(job).Scan(&job.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := createJobEventTx(tx, job.GUID, job.Status, helpers.WorkerID(), "job created"); err != nil {
+		return false, err
+	}
+
+	stmt, err = tx.PrepareNamed(submitOutputQuery)
+	if err != nil {
+		return false, err
+	}
+	job.Outputs = []models.JobOutput{}
+	for _, o := range outputs {
+		o.JobID = job.ID
+		if err := stmt.QueryRowx(&o).Scan(&o.ID); err != nil {
+			return false, err
+		}
+		job.Outputs = append(job.Outputs, o)
+	}
+
+	job.EncodeData = models.EncodeData{JobID: job.ID}
+	job.Progress.Float64, job.Progress.Valid = 0, true
+	job.Data.String, job.Data.Valid = "{}", true
+	if err := tx.QueryRowx(submitEncodeQuery, job.ID).Scan(&job.EncodeDataID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetJobByIdempotencyKey Gets a job by its idempotency key.
+func GetJobByIdempotencyKey(key string) (*models.Job, error) {
+	const query = `
+      SELECT
+        jobs.*,
+        transcode.id "transcode.id",
+        transcode.data "transcode.data",
+        transcode.progress "transcode.progress"
+      FROM jobs
+      LEFT JOIN transcode ON jobs.id = transcode.job_id
+      WHERE jobs.idempotency_key = $1 AND jobs.idempotency_key <> ''`
+
+	db, _ := ConnectDB()
+	job := models.Job{}
+	err := db.Get(&job, query, key)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &job, err
+	}
+	if job.Outputs, err = selectJobOutputs(db, job.ID); err != nil {
+		fmt.Println(err)
+	}
+	db.Close()
+	return &job, nil
+}
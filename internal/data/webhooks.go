@@ -0,0 +1,156 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+// CreateWebhookDelivery creates a webhook delivery in database.
+func CreateWebhookDelivery(d models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	const query = `
+      INSERT INTO
+        webhook_deliveries (job_id,event,url,payload,status)
+      VALUES (:job_id,:event,:url,:payload,:status)
+      RETURNING id`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	stmt, err := tx.PrepareNamed(query)
+	if err != nil {
+		fmt.Println("Error", err.Error())
+		tx.Rollback()
+		db.Close()
+		return &d, err
+	}
+
+	var id int64 // Returned ID.
+	err = stmt.QueryRowx(&d).Scan(&id)
+	if err != nil {
+		fmt.Println("Error", err.Error())
+		tx.Rollback()
+		db.Close()
+		return &d, err
+	}
+	tx.Commit()
+
+	d.ID = id
+
+	db.Close()
+	return &d, nil
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt. A
+// delivery left pending is attempted again after retryIn.
+func UpdateWebhookDelivery(d models.WebhookDelivery, retryIn time.Duration) error {
+	const query = `
+      UPDATE webhook_deliveries
+      SET status = $1, attempts = $2, response_code = $3, last_error = $4,
+        next_attempt = now() + $5 * interval '1 second',
+        updated_date = CURRENT_TIMESTAMP
+      WHERE id = $6`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.Exec(query, d.Status, d.Attempts, d.ResponseCode, d.LastError, retryIn.Seconds(), d.ID)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
+
+// RequeueWebhookDelivery Makes a delivery pending again, to be attempted
+// right away with a fresh set of attempts.
+func RequeueWebhookDelivery(id int) error {
+	const query = `
+      UPDATE webhook_deliveries
+      SET status = $1, attempts = 0, next_attempt = now(), updated_date = CURRENT_TIMESTAMP
+      WHERE id = $2`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	_, err := tx.Exec(query, models.DeliveryPending, id)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return err
+	}
+	tx.Commit()
+
+	db.Close()
+	return nil
+}
+
+// ClaimWebhookDeliveries Claims up to limit pending deliveries that are due,
+// oldest first, by pushing their next attempt back by claim. A claimed
+// delivery whose sender dies is attempted again once the claim runs out.
+func ClaimWebhookDeliveries(limit int, claim time.Duration) (*[]models.WebhookDelivery, error) {
+	const query = `
+      UPDATE webhook_deliveries
+      SET next_attempt = now() + $1 * interval '1 second'
+      WHERE id IN (
+        SELECT id FROM webhook_deliveries
+        WHERE status = $2 AND next_attempt <= now()
+        ORDER BY next_attempt
+        LIMIT $3
+        FOR UPDATE SKIP LOCKED)
+      RETURNING *`
+
+	db, _ := ConnectDB()
+	tx := db.MustBegin()
+	deliveries := []models.WebhookDelivery{}
+	err := tx.Select(&deliveries, query, claim.Seconds(), models.DeliveryPending, limit)
+	if err != nil {
+		fmt.Println(err)
+		tx.Rollback()
+		db.Close()
+		return nil, err
+	}
+	tx.Commit()
+
+	db.Close()
+	return &deliveries, nil
+}
+
+// GetWebhookDeliveryByID Gets a webhook delivery by ID.
+func GetWebhookDeliveryByID(id int) (*models.WebhookDelivery, error) {
+	const query = `SELECT * FROM webhook_deliveries WHERE id = $1`
+
+	db, _ := ConnectDB()
+	d := models.WebhookDelivery{}
+	err := db.Get(&d, query, id)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &d, err
+	}
+	db.Close()
+	return &d, nil
+}
+
+// GetWebhookDeliveriesByJobID Gets the webhook deliveries of a job, newest first.
+func GetWebhookDeliveriesByJobID(id int) (*[]models.WebhookDelivery, error) {
+	const query = `
+      SELECT * FROM webhook_deliveries
+      WHERE job_id = $1
+      ORDER BY id DESC`
+
+	db, _ := ConnectDB()
+	deliveries := []models.WebhookDelivery{}
+	err := db.Select(&deliveries, query, id)
+	if err != nil {
+		fmt.Println(err)
+		db.Close()
+		return &deliveries, err
+	}
+	db.Close()
+	return &deliveries, nil
+}
@@ -0,0 +1,73 @@
+package dispatch
+
+import (
+	"io"
+
+	"github.com/gocraft/work"
+	"github.com/gomodule/redigo/redis"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/queue"
+)
+
+// Dispatcher pushes recorded jobs onto the work queue for their action.
+type Dispatcher struct {
+	pool     *redis.Pool
+	download *work.Enqueuer
+	executor executor.Executor
+	probes   *sourceProbes
+}
+
+// New creates a dispatcher enqueueing through the given redis pool and
+// running transcode jobs on the given executor.
+func New(pool *redis.Pool, exec executor.Executor) *Dispatcher {
+	return &Dispatcher{
+		pool:     pool,
+		download: work.NewEnqueuer(config.Get().DownloadWorkerNamespace, pool),
+		executor: exec,
+		probes:   newSourceProbes(),
+	}
+}
+
+// EnqueueFrom hands a job to the scheduler to be run from the given
+// pipeline stage. An empty stage runs the whole pipeline. Only the dispatch
+// the job was read with is handed back. Submitted jobs are pending from the
+// start and need no handing over.
+func (d *Dispatcher) EnqueueFrom(job models.Job, stage string) error {
+	return data.MarkJobPending(job.GUID, stage, job.DispatchedDate)
+}
+
+// release sends a job to its work queue, or to the executor for transcode
+// jobs.
+func (d *Dispatcher) release(job models.Job) error {
+	switch job.Action {
+	case "transcode":
+		return d.executor.Run(job)
+	case "snippetize":
+	default:
+		name := queue.JobName(config.Get().DownloadWorkerJobName, job.Priority)
+		return queue.Enqueue(d.download, name, job.RunAt, queue.Args(job, job.DispatchStage))
+	}
+	return nil
+}
+
+// Logs streams the log of the worker running a job, when the executor runs
+// jobs in workers of their own.
+func (d *Dispatcher) Logs(job models.Job, pod string, follow bool) (io.ReadCloser, error) {
+	if s, ok := d.executor.(executor.LogStreamer); ok && job.Action == "transcode" {
+		return s.Logs(job, pod, follow)
+	}
+	return nil, executor.ErrNoWorker
+}
+
+// Stop drops a job from its work queue if no worker has picked it up yet,
+// and stops transcode jobs already running.
+func (d *Dispatcher) Stop(job models.Job) error {
+	if job.Action == "transcode" {
+		return d.executor.Stop(job)
+	}
+	name := queue.JobName(config.Get().DownloadWorkerJobName, job.Priority)
+	return queue.Remove(d.pool, config.Get().DownloadWorkerNamespace, name, job.GUID)
+}
@@ -0,0 +1,115 @@
+package dispatch
+
+import (
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/queue"
+	log "github.com/sirupsen/logrus"
+)
+
+// PoolStatus describes a drained pool and how many released jobs are still
+// running in it.
+type PoolStatus struct {
+	Pool    string `json:"pool"`
+	Running int    `json:"running"`
+	Drained bool   `json:"drained"`
+}
+
+// IsValidPool reports whether name is a pool that can be drained: the
+// transcode or download workers, or a configured node pool.
+func IsValidPool(name string) bool {
+	return name == queue.PoolTranscode || name == queue.PoolDownload || config.GetNodePool(name) != nil
+}
+
+// Drain stops releasing jobs to a pool, e.g. ahead of node maintenance.
+func (d *Dispatcher) Drain(pool string) error {
+	return queue.Drain(d.pool, pool)
+}
+
+// Resume releases jobs to a drained pool again.
+func (d *Dispatcher) Resume(pool string) error {
+	return queue.Resume(d.pool, pool)
+}
+
+// Draining returns the status of the pools being drained. A pool is
+// drained once none of its jobs are left running.
+func (d *Dispatcher) Draining() ([]PoolStatus, error) {
+	names, err := queue.Draining(d.pool)
+	if err != nil || len(names) == 0 {
+		return []PoolStatus{}, err
+	}
+
+	running, err := data.GetRunningJobs()
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, job := range *running {
+		for _, p := range jobPools(job) {
+			counts[p]++
+		}
+	}
+
+	statuses := make([]PoolStatus, len(names))
+	for i, name := range names {
+		statuses[i] = PoolStatus{Pool: name, Running: counts[name], Drained: counts[name] == 0}
+	}
+	return statuses, nil
+}
+
+// releasable drops the jobs bound for drained pools from a scheduling
+// pass.
+func (d *Dispatcher) releasable(jobs []models.Job) []models.Job {
+	names, err := queue.Draining(d.pool)
+	if err != nil {
+		log.Error(err)
+		return jobs
+	}
+	if len(names) == 0 {
+		return jobs
+	}
+	drained := map[string]bool{}
+	for _, name := range names {
+		drained[name] = true
+	}
+
+	kept := jobs[:0]
+	for _, job := range jobs {
+		if job.Action == "transcode" && len(job.Outputs) == 0 {
+			if outputs, err := data.GetJobOutputsByJobID(job.ID); err == nil {
+				job.Outputs = *outputs
+			}
+		}
+		held := false
+		for _, p := range jobPools(job) {
+			held = held || drained[p]
+		}
+		if !held {
+			kept = append(kept, job)
+		}
+	}
+	return kept
+}
+
+// jobPools returns the pools a job runs in: its worker pool and, for
+// transcodes shipped to Kubernetes, the node pool it is placed in.
+func jobPools(job models.Job) []string {
+	if job.Action != "transcode" {
+		return []string{queue.PoolDownload}
+	}
+	pools := []string{queue.PoolTranscode}
+	if e := config.Get().Executor; e != executor.TypeKubernetes && e != "" {
+		return pools
+	}
+
+	profiles := []string{job.Profile}
+	for _, o := range job.Outputs {
+		profiles = append(profiles, o.Profile)
+	}
+	if pool := config.JobNodePool(profiles, job.Priority); pool != nil {
+		pools = append(pools, pool.Name)
+	}
+	return pools
+}
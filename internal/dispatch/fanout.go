@@ -0,0 +1,68 @@
+package dispatch
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/storage"
+	"github.com/rs/xid"
+)
+
+// PrefixJob is the work planned for one object under a storage prefix.
+type PrefixJob struct {
+	Source  string
+	Name    string
+	Outputs []models.JobOutput
+}
+
+// PrefixJobs lists the objects under a storage prefix and plans the outputs
+// of each for the given profiles, written under dest as <name>_<profile><ext>.
+func PrefixJobs(prefix, dest string, profiles []string) ([]PrefixJob, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles given")
+	}
+	for _, profile := range profiles {
+		if _, err := config.GetFFmpegProfile(profile); err != nil {
+			return nil, fmt.Errorf("unknown profile %s", profile)
+		}
+	}
+
+	files, err := storage.ListFiles(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []PrefixJob{}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+
+		specs := []models.OutputSpec{}
+		for _, profile := range profiles {
+			p, _ := config.GetFFmpegProfile(profile)
+			specs = append(specs, models.OutputSpec{
+				Profile:     profile,
+				Destination: fmt.Sprintf("%s/%s_%s%s", strings.TrimSuffix(dest, "/"), name, profile, p.Output),
+			})
+		}
+		jobs = append(jobs, PrefixJob{
+			Source:  file,
+			Name:    name,
+			Outputs: models.NewJobOutputs("", nil, specs),
+		})
+	}
+	return jobs, nil
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// GenerateJobID returns a c24_job_id for a job the transcoder creates
+// itself. It doubles as a Kubernetes Job name, so it is kept to lowercase
+// letters, digits and dashes.
+func GenerateJobID(prefix string) string {
+	name := strings.Trim(nonNameChars.ReplaceAllString(strings.ToLower(prefix), "-"), "-")
+	return fmt.Sprintf("%s-%s", name, xid.New().String())
+}
@@ -0,0 +1,101 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// sourceProbeConcurrency bounds how many sources are probed at once.
+	sourceProbeConcurrency = 4
+
+	// sourceProbeTimeout bounds probing one source.
+	sourceProbeTimeout = 30 * time.Second
+)
+
+// sourceProbes probes the sources of pending jobs off the scheduling pass
+// and records the probe data on the job, for the executor to size its pod
+// by.
+type sourceProbes struct {
+	mu sync.Mutex
+	// probing maps the GUIDs of jobs probed in this process to whether the
+	// probe still runs.
+	probing map[string]bool
+	slots   chan struct{}
+}
+
+func newSourceProbes() *sourceProbes {
+	return &sourceProbes{
+		probing: map[string]bool{},
+		slots:   make(chan struct{}, sourceProbeConcurrency),
+	}
+}
+
+// hold starts probing the sources of the jobs that need it and returns the
+// jobs of a scheduling pass not waiting on a probe. A job is held while its
+// probe runs, or waits for a free slot; one whose probe failed is released
+// with its profile's resources.
+func (p *sourceProbes) hold(jobs []models.Job) []models.Job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending := map[string]bool{}
+	kept := jobs[:0]
+	for _, job := range jobs {
+		pending[job.GUID] = true
+		running, probed := p.probing[job.GUID]
+		if running {
+			continue
+		}
+		if !probed && executor.NeedsSourceProbe(job) {
+			select {
+			case p.slots <- struct{}{}:
+				p.probing[job.GUID] = true
+				go p.probe(job)
+			default:
+			}
+			continue
+		}
+		kept = append(kept, job)
+	}
+
+	// Forget jobs no longer pending.
+	for guid, running := range p.probing {
+		if !running && !pending[guid] {
+			delete(p.probing, guid)
+		}
+	}
+	return kept
+}
+
+func (p *sourceProbes) probe(job models.Job) {
+	defer func() {
+		<-p.slots
+		p.mu.Lock()
+		p.probing[job.GUID] = false
+		p.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sourceProbeTimeout)
+	defer cancel()
+	probeData, err := executor.ProbeSource(ctx, job)
+	if err != nil {
+		log.Errorf("could not probe source of job %s: %v", job.GUID, err)
+		return
+	}
+	b, err := json.Marshal(probeData)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if err := data.UpdateEncodeDataByID(job.EncodeDataID, string(b)); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,187 @@
+package dispatch
+
+import (
+	"context"
+	"time"
+
+	"github.com/harisbeha/media-transcoder/internal/capability"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// pendingPerTenant bounds how many pending jobs of each tenant one
+// scheduling pass looks at.
+const pendingPerTenant = 100
+
+// rerouteInterval is how often jobs queued for worker groups that are gone
+// are handed back to be routed again.
+const rerouteInterval = 30 * time.Second
+
+// Run releases pending jobs to their work queues until ctx is done. It
+// starts the executor's own workers, if it has any.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if w, ok := d.executor.(executor.Worker); ok {
+		w.Start()
+		defer w.Close()
+	}
+
+	ticker := time.NewTicker(schedulerInterval())
+	defer ticker.Stop()
+
+	var reroutedAt time.Time
+	for {
+		if r, ok := d.executor.(executor.Rerouter); ok && time.Since(reroutedAt) >= rerouteInterval {
+			reroutedAt = time.Now()
+			if err := r.Reroute(); err != nil {
+				log.Error(err)
+			}
+		}
+		if err := d.schedule(); err != nil {
+			log.Error(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func schedulerInterval() time.Duration {
+	if interval := config.Get().SchedulerInterval; interval > 0 {
+		return interval
+	}
+	return 2 * time.Second
+}
+
+// schedule runs one weighted fair-share pass: while slots are free, the
+// tenant using the smallest share of its weight and still under its cap
+// releases its next job. Within a tenant, higher priority jobs go first.
+func (d *Dispatcher) schedule() error {
+	// Jobs due before the next pass are released now and held back by the
+	// work queue until their run time.
+	pending, err := data.GetPendingJobs(pendingPerTenant, time.Now().Add(schedulerInterval()))
+	if err != nil {
+		return err
+	}
+	jobs := d.probes.hold(d.releasable(*pending))
+	if len(jobs) == 0 {
+		return nil
+	}
+	running, err := data.GetRunningCounts()
+	if err != nil {
+		return err
+	}
+
+	queues := map[string][]models.Job{}
+	for _, job := range jobs {
+		queues[job.Tenant] = append(queues[job.Tenant], job)
+	}
+
+	limited, slots := freeSlots(config.Get().SchedulerMaxConcurrency, running)
+	if limited && slots <= 0 {
+		return nil
+	}
+
+	for !limited || slots > 0 {
+		tenant, ok := nextTenant(queues, running)
+		if !ok {
+			break
+		}
+		job := queues[tenant][0]
+		queues[tenant] = queues[tenant][1:]
+
+		released, err := d.dispatch(job)
+		if err != nil {
+			log.Errorf("dispatch: job %s: %v", job.GUID, err)
+			continue
+		}
+		if released {
+			running[tenant]++
+			slots--
+		}
+	}
+	return nil
+}
+
+// freeSlots returns how many more jobs may run under a cap of max running
+// jobs, and whether there is a cap at all. More jobs may run than the cap
+// allows after it was lowered, or while finished jobs are yet to be
+// reconciled; no slots are free then.
+func freeSlots(max int, running map[string]int) (bool, int) {
+	if max <= 0 {
+		return false, 0
+	}
+	total := 0
+	for _, n := range running {
+		total += n
+	}
+	if total >= max {
+		return true, 0
+	}
+	return true, max - total
+}
+
+// nextTenant picks the tenant with pending jobs, room under its cap and the
+// lowest running count relative to its weight.
+func nextTenant(queues map[string][]models.Job, running map[string]int) (string, bool) {
+	var best string
+	var bestShare float64
+	found := false
+
+	for tenant, jobs := range queues {
+		if len(jobs) == 0 {
+			continue
+		}
+		if max := config.TenantMaxConcurrency(tenant); max > 0 && running[tenant] >= max {
+			continue
+		}
+		share := float64(running[tenant]) / float64(config.TenantWeight(tenant))
+		if !found || share < bestShare || (share == bestShare && before(jobs[0], queues[best][0])) {
+			best, bestShare, found = tenant, share, true
+		}
+	}
+	return best, found
+}
+
+// before breaks ties between tenants by the priority, then age, of their
+// next jobs.
+func before(a, b models.Job) bool {
+	ra, rb := priorityRank(a.Priority), priorityRank(b.Priority)
+	if ra != rb {
+		return ra < rb
+	}
+	return a.ID < b.ID
+}
+
+func priorityRank(priority string) int {
+	for i, p := range models.Priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return len(models.Priorities)
+}
+
+// dispatch claims a pending job and releases it to its work queue. A job
+// claimed by another dispatcher is skipped, and one no live worker is
+// capable of running is held until one is.
+func (d *Dispatcher) dispatch(job models.Job) (bool, error) {
+	claimed, err := data.MarkJobDispatched(&job)
+	if err != nil || !claimed {
+		return false, err
+	}
+	err = d.release(job)
+	if err == capability.ErrNoCapableWorker {
+		log.Debugf("dispatch: job %s: %v, holding", job.GUID, err)
+		return false, data.MarkJobPending(job.GUID, job.DispatchStage, job.DispatchedDate)
+	}
+	if err != nil {
+		data.UpdateJobStatusWithMessage(job.GUID, models.JobError, err.Error())
+		return false, err
+	}
+	return true, nil
+}
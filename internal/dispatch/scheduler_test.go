@@ -0,0 +1,163 @@
+package dispatch
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+const testConfig = `
+tenant_max_concurrency: 3
+tenants:
+  - tenant: big
+    weight: 3
+    max_concurrency: 6
+  - tenant: small
+    weight: 1
+`
+
+func loadTestConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "scheduler-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	config.LoadConfig(f.Name())
+}
+
+func pendingJobs(tenant, priority string, firstID int64, n int) []models.Job {
+	jobs := make([]models.Job, n)
+	for i := range jobs {
+		jobs[i] = models.Job{ID: firstID + int64(i), Tenant: tenant, Priority: priority}
+	}
+	return jobs
+}
+
+func TestNextTenant(t *testing.T) {
+	loadTestConfig(t)
+
+	tests := []struct {
+		name    string
+		queues  map[string][]models.Job
+		running map[string]int
+		want    string
+		ok      bool
+	}{
+		{
+			name: "no pending jobs",
+			queues: map[string][]models.Job{
+				"big": nil,
+			},
+			running: map[string]int{},
+			ok:      false,
+		},
+		{
+			name: "smallest share of weight",
+			queues: map[string][]models.Job{
+				"big":   pendingJobs("big", models.PriorityNormal, 1, 1),
+				"small": pendingJobs("small", models.PriorityNormal, 2, 1),
+			},
+			running: map[string]int{"big": 2, "small": 1},
+			want:    "big",
+			ok:      true,
+		},
+		{
+			name: "tenant at its own cap",
+			queues: map[string][]models.Job{
+				"big":   pendingJobs("big", models.PriorityNormal, 1, 1),
+				"small": pendingJobs("small", models.PriorityNormal, 2, 1),
+			},
+			running: map[string]int{"big": 6, "small": 2},
+			want:    "small",
+			ok:      true,
+		},
+		{
+			name: "unlisted tenant at the default cap",
+			queues: map[string][]models.Job{
+				"other": pendingJobs("other", models.PriorityNormal, 1, 1),
+			},
+			running: map[string]int{"other": 3},
+			ok:      false,
+		},
+		{
+			name: "tie broken by priority",
+			queues: map[string][]models.Job{
+				"small": pendingJobs("small", models.PriorityNormal, 1, 1),
+				"other": pendingJobs("other", models.PriorityHigh, 2, 1),
+			},
+			running: map[string]int{},
+			want:    "other",
+			ok:      true,
+		},
+		{
+			name: "tie broken by age",
+			queues: map[string][]models.Job{
+				"small": pendingJobs("small", models.PriorityLow, 5, 1),
+				"other": pendingJobs("other", models.PriorityLow, 2, 1),
+			},
+			running: map[string]int{},
+			want:    "other",
+			ok:      true,
+		},
+	}
+	for _, tt := range tests {
+		got, ok := nextTenant(tt.queues, tt.running)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: nextTenant = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNextTenantSharesByWeight(t *testing.T) {
+	loadTestConfig(t)
+
+	queues := map[string][]models.Job{
+		"big":   pendingJobs("big", models.PriorityNormal, 1, 10),
+		"small": pendingJobs("small", models.PriorityNormal, 100, 10),
+	}
+	running := map[string]int{}
+	for i := 0; i < 9; i++ {
+		tenant, ok := nextTenant(queues, running)
+		if !ok {
+			t.Fatalf("release %d: no tenant picked", i)
+		}
+		queues[tenant] = queues[tenant][1:]
+		running[tenant]++
+	}
+	if running["big"] != 6 || running["small"] != 3 {
+		t.Errorf("running = %v, want big 6 and small 3", running)
+	}
+
+	// Both tenants are now at their caps.
+	if tenant, ok := nextTenant(queues, running); ok {
+		t.Errorf("nextTenant = %q past the caps", tenant)
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	tests := []struct {
+		max     int
+		running map[string]int
+		limited bool
+		slots   int
+	}{
+		{0, map[string]int{"a": 50}, false, 0},
+		{10, map[string]int{}, true, 10},
+		{10, map[string]int{"a": 3, "b": 4}, true, 3},
+		{10, map[string]int{"a": 10}, true, 0},
+		{10, map[string]int{"a": 8, "b": 7}, true, 0},
+	}
+	for _, tt := range tests {
+		limited, slots := freeSlots(tt.max, tt.running)
+		if limited != tt.limited || slots != tt.slots {
+			t.Errorf("freeSlots(%d, %v) = %v, %d, want %v, %d", tt.max, tt.running, limited, slots, tt.limited, tt.slots)
+		}
+	}
+}
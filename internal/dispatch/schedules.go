@@ -0,0 +1,156 @@
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/robfig/cron"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+)
+
+// scheduleCheckInterval is how often the dispatcher looks for due schedules.
+const scheduleCheckInterval = 15 * time.Second
+
+// ScheduleStatus describes a recurring schedule and when it runs.
+type ScheduleStatus struct {
+	Name        string     `json:"name"`
+	Cron        string     `json:"cron"`
+	Source      string     `json:"source"`
+	Destination string     `json:"dest"`
+	Profiles    []string   `json:"profiles"`
+	Action      string     `json:"action"`
+	Tenant      string     `json:"tenant"`
+	Priority    string     `json:"priority"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Schedules returns the configured recurring schedules with their last and
+// next runs.
+func Schedules() []ScheduleStatus {
+	now := time.Now()
+	schedules := []ScheduleStatus{}
+	for _, s := range config.Get().Schedules {
+		status := ScheduleStatus{
+			Name:        s.Name,
+			Cron:        s.Cron,
+			Source:      s.Source,
+			Destination: s.Destination,
+			Profiles:    s.Profiles,
+			Action:      scheduleAction(s.Action),
+			Tenant:      s.Tenant,
+			Priority:    s.Priority,
+		}
+		if sched, err := cron.ParseStandard(s.Cron); err != nil {
+			status.Error = err.Error()
+		} else {
+			next := sched.Next(now)
+			status.NextRun = &next
+		}
+		if last, err := data.GetLastScheduledRun(s.Name); err == nil {
+			status.LastRun = last
+		}
+		schedules = append(schedules, status)
+	}
+	return schedules
+}
+
+// RunSchedules submits the jobs of each recurring schedule as it comes due,
+// until ctx is done.
+func (d *Dispatcher) RunSchedules(ctx context.Context) {
+	next := map[string]time.Time{}
+	for _, s := range config.Get().Schedules {
+		sched, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			log.Errorf("schedule %s: %v", s.Name, err)
+			continue
+		}
+		next[s.Name] = sched.Next(time.Now())
+	}
+
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, s := range config.Get().Schedules {
+				at, ok := next[s.Name]
+				if !ok || now.Before(at) {
+					continue
+				}
+				sched, _ := cron.ParseStandard(s.Cron)
+				next[s.Name] = sched.Next(now)
+
+				n, err := d.runSchedule(s.Name, at)
+				if err != nil {
+					log.Errorf("schedule %s: %v", s.Name, err)
+				}
+				log.Infof("schedule %s: submitted %d jobs", s.Name, n)
+			}
+		}
+	}
+}
+
+// runSchedule submits a job for every object under the schedule's source
+// prefix. Jobs are keyed on the schedule run, so a run repeated by another
+// dispatcher does not submit them twice.
+func (d *Dispatcher) runSchedule(name string, at time.Time) (int, error) {
+	s, err := config.GetSchedule(name)
+	if err != nil {
+		return 0, err
+	}
+	if s.Priority != "" && !models.IsValidPriority(s.Priority) {
+		return 0, fmt.Errorf("not a valid priority: %q", s.Priority)
+	}
+
+	planned, err := PrefixJobs(s.Source, s.Destination, s.Profiles)
+	if err != nil {
+		return 0, err
+	}
+
+	submitted := 0
+	for _, pj := range planned {
+		outputs := pj.Outputs
+		job := models.Job{
+			GUID:     xid.New().String(),
+			C24JobID: GenerateJobID(s.Name),
+			Profile:  outputs[0].Profile,
+			Action:   scheduleAction(s.Action),
+			Meta: models.JobMetadata{
+				"schedule":      s.Name,
+				"scheduled_for": at.Format(time.RFC3339),
+			},
+			Source:         pj.Source,
+			Destination:    s.Destination,
+			IdempotencyKey: fmt.Sprintf("schedule:%s:%d:%s", s.Name, at.Unix(), pj.Source),
+			Tenant:         s.Tenant,
+			Priority:       s.Priority,
+			Status:         models.JobQueued,
+		}
+
+		_, isNew, err := data.SubmitJob(job, outputs)
+		if err != nil {
+			return submitted, err
+		}
+		if isNew {
+			submitted++
+		}
+	}
+	return submitted, nil
+}
+
+func scheduleAction(action string) string {
+	if action == "" {
+		return "transcode"
+	}
+	return action
+}
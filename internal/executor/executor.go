@@ -0,0 +1,87 @@
+// Package executor runs the transcode jobs the dispatcher releases, in a
+// Kubernetes cluster, in a local worker pool or in process.
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gomodule/redigo/redis"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/kube"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+// Executor types.
+const (
+	TypeKubernetes = "kubernetes"
+	TypeLocal      = "local"
+	TypeInProcess  = "inprocess"
+)
+
+// Executor runs released transcode jobs.
+type Executor interface {
+	// Run starts a released job from its dispatch stage. It may return
+	// before the job finishes.
+	Run(job models.Job) error
+	// Stop drops a job's pending work and stops any that is running.
+	Stop(job models.Job) error
+}
+
+// Worker is implemented by executors running jobs in workers of their own.
+// The dispatcher starts them once it starts releasing jobs, so processes
+// that only submit or cancel jobs run no workers.
+type Worker interface {
+	Start()
+	Close()
+}
+
+// Rerouter is implemented by executors routing jobs to groups of workers.
+// The dispatcher has them hand back the jobs left queued for groups whose
+// workers are all gone, to be routed again.
+type Rerouter interface {
+	Reroute() error
+}
+
+// LogStreamer is implemented by executors running jobs in workers whose
+// logs they can stream.
+type LogStreamer interface {
+	// Logs streams the log of the worker running a job; of the given pod,
+	// or of the latest one when pod is empty. It returns ErrNoWorker when
+	// no such worker is left.
+	Logs(job models.Job, pod string, follow bool) (io.ReadCloser, error)
+}
+
+// ErrNoWorker is returned for logs of a worker that is gone.
+var ErrNoWorker = errors.New("no worker running the job")
+
+// New creates the executor named in config.
+func New(pool *redis.Pool) (Executor, error) {
+	switch config.Get().Executor {
+	case TypeKubernetes, "":
+		clientset, err := kube.NewClientset()
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes executor: %v", err)
+		}
+		template, err := kube.LoadTemplate()
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes executor: %v", err)
+		}
+		return NewKube(clientset, pool, template), nil
+	case TypeLocal:
+		return NewLocal(pool, concurrency()), nil
+	case TypeInProcess:
+		return NewInProcess(concurrency()), nil
+	}
+	return nil, fmt.Errorf("unknown executor %q", config.Get().Executor)
+}
+
+// concurrency returns how many jobs the local and in-process executors run
+// at once.
+func concurrency() uint {
+	if n := config.Get().ExecutorConcurrency; n > 0 {
+		return n
+	}
+	return config.Get().WorkerConcurrency
+}
@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"sync"
+
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// InProcess runs transcode jobs in goroutines of the caller, without a work
+// queue, at most concurrency at once. It suits tests and one-off runs.
+type InProcess struct {
+	// run runs a job's pipeline from a stage.
+	run func(job models.Job, stage string) error
+
+	slots   chan struct{}
+	running sync.WaitGroup
+}
+
+// NewInProcess creates an in-process executor running up to concurrency
+// jobs at once.
+func NewInProcess(concurrency uint) *InProcess {
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	return &InProcess{
+		run:   actions.RunEncodeJobFrom,
+		slots: make(chan struct{}, concurrency),
+	}
+}
+
+// Run starts a job once a slot is free, waiting for one while all are
+// taken. Failures are recorded on the job by the pipeline itself.
+func (e *InProcess) Run(job models.Job) error {
+	e.slots <- struct{}{}
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		defer func() { <-e.slots }()
+		if err := e.run(job, job.DispatchStage); err != nil {
+			log.Errorf("executor: job %s failed: %v", job.GUID, err)
+		}
+	}()
+	return nil
+}
+
+// Stop does nothing; a running job stops by itself once it sees it was
+// cancelled.
+func (e *InProcess) Stop(job models.Job) error {
+	return nil
+}
+
+// Start does nothing; jobs run as they are released.
+func (e *InProcess) Start() {}
+
+// Close waits for running jobs to finish.
+func (e *InProcess) Close() {
+	e.running.Wait()
+}
@@ -0,0 +1,180 @@
+package executor
+
+import (
+	"io"
+	"strings"
+
+	"github.com/gocraft/work"
+	"github.com/gomodule/redigo/redis"
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/kube"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/queue"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxJobNamePrefix leaves room in a Job name, at most 63 characters, for a
+// dash and an xid.
+const maxJobNamePrefix = 42
+
+// Kube runs each transcode job in a Kubernetes Job of its own, whose worker
+// consumes the job's queue entry. Its watcher reconciles job statuses with
+// the Jobs and their pods.
+type Kube struct {
+	clientset kubernetes.Interface
+	pool      *redis.Pool
+	enqueuer  *work.Enqueuer
+	template  *kube.Template
+	namespace string
+	watcher   *Watcher
+
+	// getJob looks up a job with its outputs and probe data.
+	getJob func(guid string) (*models.Job, error)
+}
+
+// NewKube creates an executor shipping jobs built from a template through
+// the given clientset. Tests may pass client-go's fake clientset.
+func NewKube(clientset kubernetes.Interface, pool *redis.Pool, template *kube.Template) *Kube {
+	namespace := template.Namespace()
+	return &Kube{
+		clientset: clientset,
+		pool:      pool,
+		enqueuer:  work.NewEnqueuer(config.Get().TranscodeWorkerNamespace, pool),
+		template:  template,
+		namespace: namespace,
+		watcher:   NewWatcher(clientset, namespace),
+		getJob:    data.GetJobByGUID,
+	}
+}
+
+// Start starts watching the executor's Kubernetes Jobs.
+func (k *Kube) Start() {
+	k.watcher.Start()
+}
+
+// Close stops watching the executor's Kubernetes Jobs.
+func (k *Kube) Close() {
+	k.watcher.Close()
+}
+
+// Run enqueues a job under its own name and ships a Kubernetes Job to run it.
+func (k *Kube) Run(job models.Job) error {
+	name := queue.JobName(job.GUID, job.Priority)
+	if err := queue.Enqueue(k.enqueuer, name, job.RunAt, queue.Args(job, job.DispatchStage)); err != nil {
+		return err
+	}
+
+	kubeJob := k.newKubeJob(job)
+	created, err := k.clientset.BatchV1().Jobs(k.namespace).Create(kubeJob)
+	if err != nil {
+		if err := queue.Remove(k.pool, config.Get().TranscodeWorkerNamespace, name, job.GUID); err != nil {
+			log.Error(err)
+		}
+		return err
+	}
+	log.Info(created.Name, created.Status)
+	return nil
+}
+
+// Stop drops a job's queue entry and deletes the Kubernetes Jobs running it.
+func (k *Kube) Stop(job models.Job) error {
+	name := queue.JobName(job.GUID, job.Priority)
+	if err := queue.Remove(k.pool, config.Get().TranscodeWorkerNamespace, name, job.GUID); err != nil {
+		return err
+	}
+	return kube.DeleteJobs(k.clientset, k.namespace, job.GUID)
+}
+
+// Logs streams the log of a pod running a job.
+func (k *Kube) Logs(job models.Job, pod string, follow bool) (io.ReadCloser, error) {
+	pods, err := kube.JobPods(k.clientset, k.namespace, job.GUID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(pods) - 1; i >= 0; i-- {
+		if pod != "" && pods[i].Name != pod {
+			continue
+		}
+		// A pod yet to start its container has no log.
+		if pods[i].Status.Phase == apiv1.PodPending {
+			return nil, ErrNoWorker
+		}
+		return kube.PodLogs(k.clientset, k.namespace, pods[i].Name, follow)
+	}
+	return nil, ErrNoWorker
+}
+
+func (k *Kube) newKubeJob(job models.Job) *batchv1.Job {
+	// The dispatched job carries no outputs or probe data.
+	j, err := k.getJob(job.GUID)
+	if err != nil {
+		j = &job
+	}
+
+	r := jobResources(*j)
+	nodePool := ""
+	if pool := config.JobNodePool(jobProfiles(*j), j.Priority); pool != nil {
+		nodePool = pool.Name
+	}
+
+	actionArg := "transcoder"
+	if job.Action == "download" {
+		actionArg = "downloader"
+	}
+
+	opts := []func(*batchv1.Job){
+		kube.WithJobNameEnv(job.GUID),
+		kube.WithCommandArgs(actionArg),
+		kube.WithJobName(kubeJobName(job)),
+		kube.WithLabel(kube.LabelJobGUID, job.GUID),
+		kube.WithMaxParallelism("1"),
+		kube.WithMaxRetries("1"),
+		kube.WithTTLCleanupTime(int32(0)),
+		kube.WithTerminationGracePeriod(int64(actions.TerminationGracePeriod().Seconds())),
+		kube.WithResourceLimit(r.CPULimit.String(), r.MemoryLimit.String()),
+		kube.WithResourceRequest(r.CPURequest.String(), r.MemoryRequest.String()),
+	}
+	if j.DispatchedDate.Valid {
+		opts = append(opts, kube.WithAnnotation(kube.AnnotationDispatchedDate, j.DispatchedDate.String))
+	}
+	return k.template.New(nodePool, opts...)
+}
+
+// kubeJobName names the Kubernetes Job of one run of a job after its c24 job
+// ID, with a unique suffix: retried jobs run again while the Jobs of earlier
+// runs may still be around, and c24 job IDs may be shared. The Jobs of a job
+// are found by its GUID label instead.
+func kubeJobName(job models.Job) string {
+	prefix := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(job.C24JobID))
+	if len(prefix) > maxJobNamePrefix {
+		prefix = prefix[:maxJobNamePrefix]
+	}
+	prefix = strings.Trim(prefix, "-")
+	if prefix == "" {
+		prefix = "transcode"
+	}
+	return prefix + "-" + xid.New().String()
+}
+
+// jobProfiles returns the profiles of a job's outputs.
+func jobProfiles(job models.Job) []string {
+	profiles := []string{}
+	if job.Profile != "" {
+		profiles = append(profiles, job.Profile)
+	}
+	for _, o := range job.Outputs {
+		profiles = append(profiles, o.Profile)
+	}
+	return profiles
+}
@@ -0,0 +1,308 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/kube"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeRedis is an in-memory redis serving the list and sorted set commands
+// the work queue uses.
+type fakeRedis struct {
+	lists map[string][][]byte
+	zsets map[string][][]byte
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{lists: map[string][][]byte{}, zsets: map[string][][]byte{}}
+}
+
+func (r *fakeRedis) pool() *redis.Pool {
+	return &redis.Pool{Dial: func() (redis.Conn, error) { return r, nil }}
+}
+
+func (r *fakeRedis) Close() error                      { return nil }
+func (r *fakeRedis) Err() error                        { return nil }
+func (r *fakeRedis) Send(string, ...interface{}) error { return nil }
+func (r *fakeRedis) Flush() error                      { return nil }
+func (r *fakeRedis) Receive() (interface{}, error)     { return nil, nil }
+
+func (r *fakeRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	switch cmd {
+	case "":
+		return nil, nil
+	case "SADD":
+		return int64(1), nil
+	case "LPUSH":
+		key := args[0].(string)
+		r.lists[key] = append([][]byte{toBytes(args[1])}, r.lists[key]...)
+		return int64(len(r.lists[key])), nil
+	case "ZADD":
+		key := args[0].(string)
+		r.zsets[key] = append(r.zsets[key], toBytes(args[2]))
+		return int64(1), nil
+	case "LRANGE":
+		return values(r.lists[args[0].(string)]), nil
+	case "ZRANGE":
+		return values(r.zsets[args[0].(string)]), nil
+	case "LREM":
+		key := args[0].(string)
+		r.lists[key] = remove(r.lists[key], toBytes(args[2]))
+		return int64(1), nil
+	case "ZREM":
+		key := args[0].(string)
+		r.zsets[key] = remove(r.zsets[key], toBytes(args[1]))
+		return int64(1), nil
+	}
+	return nil, fmt.Errorf("fake redis: unsupported command %s", cmd)
+}
+
+func toBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+func values(items [][]byte) []interface{} {
+	vs := make([]interface{}, len(items))
+	for i, item := range items {
+		vs[i] = item
+	}
+	return vs
+}
+
+func remove(items [][]byte, item []byte) [][]byte {
+	kept := [][]byte{}
+	for _, i := range items {
+		if !bytes.Equal(i, item) {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+func newTestKube(t *testing.T, clientset *fake.Clientset) (*Kube, *fakeRedis) {
+	config.C.TranscodeWorkerNamespace = "transcode"
+	config.C.Resources.CPURequest = "500m"
+	config.C.Resources.CPULimit = "1"
+	config.C.Resources.MemoryRequest = "1Gi"
+	config.C.Resources.MemoryLimit = "2Gi"
+
+	template, err := kube.LoadTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newFakeRedis()
+	k := NewKube(clientset, r.pool(), template)
+	k.getJob = func(string) (*models.Job, error) { return nil, errors.New("no database") }
+	return k, r
+}
+
+func testJob() models.Job {
+	return models.Job{GUID: "bq2b1vp4vqs5v3j6mtag", C24JobID: "Clip_42", Action: "transcode"}
+}
+
+const testQueueKey = "transcode:jobs:bq2b1vp4vqs5v3j6mtag"
+
+func TestKubeRun(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	k, r := newTestKube(t, clientset)
+	job := testJob()
+	k.getJob = func(string) (*models.Job, error) {
+		j := testJob()
+		j.DispatchedDate.String, j.DispatchedDate.Valid = "2019-10-01T12:00:00Z", true
+		return &j, nil
+	}
+
+	if err := k.Run(job); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.lists[testQueueKey]); n != 1 {
+		t.Fatalf("queue entries = %d, want 1", n)
+	}
+
+	list, err := clientset.BatchV1().Jobs(k.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("jobs = %d, want 1", len(list.Items))
+	}
+	created := list.Items[0]
+	if got := created.Labels[kube.LabelJobGUID]; got != job.GUID {
+		t.Errorf("job label = %q, want %q", got, job.GUID)
+	}
+	if got := created.Spec.Template.Labels[kube.LabelJobGUID]; got != job.GUID {
+		t.Errorf("pod label = %q, want %q", got, job.GUID)
+	}
+	if got := created.Annotations[kube.AnnotationDispatchedDate]; got != "2019-10-01T12:00:00Z" {
+		t.Errorf("dispatched date = %q, want the job's", got)
+	}
+	if !strings.HasPrefix(created.Name, "clip-42-") {
+		t.Errorf("name = %q, want prefix clip-42-", created.Name)
+	}
+
+	res := created.Spec.Template.Spec.Containers[0].Resources
+	for _, c := range []struct{ name, got, want string }{
+		{"cpu request", res.Requests.Cpu().String(), "500m"},
+		{"cpu limit", res.Limits.Cpu().String(), "1"},
+		{"memory request", res.Requests.Memory().String(), "1Gi"},
+		{"memory limit", res.Limits.Memory().String(), "2Gi"},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %s, want %s", c.name, c.got, c.want)
+		}
+	}
+
+	// A rerun of the job gets a Job of its own.
+	if err := k.Run(job); err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+}
+
+func TestKubeRunRollsBackQueueEntry(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "jobs", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("quota exceeded")
+	})
+	k, r := newTestKube(t, clientset)
+
+	if err := k.Run(testJob()); err == nil {
+		t.Fatal("Run succeeded, want the create error")
+	}
+	if n := len(r.lists[testQueueKey]); n != 0 {
+		t.Errorf("queue entries = %d, want 0", n)
+	}
+}
+
+func TestKubeStop(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	var selector string
+	clientset.PrependReactor("delete-collection", "jobs", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		selector = a.(k8stesting.DeleteCollectionAction).GetListRestrictions().Labels.String()
+		return true, nil, nil
+	})
+	k, r := newTestKube(t, clientset)
+	job := testJob()
+
+	if err := k.Run(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Stop(job); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.lists[testQueueKey]); n != 0 {
+		t.Errorf("queue entries = %d, want 0", n)
+	}
+	if want := kube.LabelJobGUID + "=" + job.GUID; selector != want {
+		t.Errorf("deleted jobs matching %q, want %q", selector, want)
+	}
+}
+
+func TestKubeLogs(t *testing.T) {
+	job := testJob()
+	pending := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "clip-42-abc",
+			Labels: map[string]string{kube.LabelJobGUID: job.GUID},
+		},
+		Status: apiv1.PodStatus{Phase: apiv1.PodPending},
+	}
+
+	k, _ := newTestKube(t, fake.NewSimpleClientset())
+	if _, err := k.Logs(job, "", false); err != ErrNoWorker {
+		t.Errorf("no pod: err = %v, want ErrNoWorker", err)
+	}
+
+	pending.Namespace = k.namespace
+	k, _ = newTestKube(t, fake.NewSimpleClientset(pending))
+	if _, err := k.Logs(job, "", false); err != ErrNoWorker {
+		t.Errorf("pending pod: err = %v, want ErrNoWorker", err)
+	}
+	if _, err := k.Logs(job, "other-pod", false); err != ErrNoWorker {
+		t.Errorf("unknown pod: err = %v, want ErrNoWorker", err)
+	}
+}
+
+func TestInProcessRun(t *testing.T) {
+	e := NewInProcess(1)
+	var ran models.Job
+	var stage string
+	e.run = func(job models.Job, s string) error {
+		ran, stage = job, s
+		return errors.New("encode failed")
+	}
+
+	job := testJob()
+	job.DispatchStage = "encode"
+	// Failures are recorded on the job, not returned to the dispatcher.
+	if err := e.Run(job); err != nil {
+		t.Errorf("Run = %v, want nil", err)
+	}
+	e.Close()
+	if ran.GUID != job.GUID || stage != "encode" {
+		t.Errorf("ran job %q from %q, want %q from encode", ran.GUID, stage, job.GUID)
+	}
+	if err := e.Stop(job); err != nil {
+		t.Errorf("Stop = %v, want nil", err)
+	}
+}
+
+func TestInProcessConcurrency(t *testing.T) {
+	e := NewInProcess(2)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	running, peak := 0, 0
+	e.run = func(job models.Job, s string) error {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+
+	// Run returns for the first two jobs and waits for a slot for the third.
+	e.Run(testJob())
+	e.Run(testJob())
+	third := make(chan struct{})
+	go func() {
+		e.Run(testJob())
+		close(third)
+	}()
+	select {
+	case <-third:
+		t.Fatal("third job started while both slots were taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-third
+	e.Close()
+	if peak != 2 {
+		t.Errorf("peak running jobs = %d, want 2", peak)
+	}
+}
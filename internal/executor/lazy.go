@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"io"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Lazy creates the configured executor on first use, and again on later
+// calls while it can't be created, e.g. a Kubernetes executor outside the
+// cluster. Processes that only cancel jobs or stream their logs, like the
+// API server, start without one.
+type Lazy struct {
+	pool *redis.Pool
+
+	mu   sync.Mutex
+	exec Executor
+}
+
+// NewLazy creates an executor creating the configured one on first use.
+func NewLazy(pool *redis.Pool) *Lazy {
+	return &Lazy{pool: pool}
+}
+
+func (l *Lazy) get() (Executor, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exec == nil {
+		exec, err := New(l.pool)
+		if err != nil {
+			return nil, err
+		}
+		l.exec = exec
+	}
+	return l.exec, nil
+}
+
+// Run runs a job on the configured executor.
+func (l *Lazy) Run(job models.Job) error {
+	exec, err := l.get()
+	if err != nil {
+		return err
+	}
+	return exec.Run(job)
+}
+
+// Stop stops a job on the configured executor.
+func (l *Lazy) Stop(job models.Job) error {
+	exec, err := l.get()
+	if err != nil {
+		return err
+	}
+	return exec.Stop(job)
+}
+
+// Logs streams the log of the worker running a job, when the configured
+// executor can. It returns ErrNoWorker when the executor can't be created,
+// so callers fall back to archived logs.
+func (l *Lazy) Logs(job models.Job, pod string, follow bool) (io.ReadCloser, error) {
+	exec, err := l.get()
+	if err != nil {
+		log.Warnf("executor: %v", err)
+		return nil, ErrNoWorker
+	}
+	if s, ok := exec.(LogStreamer); ok {
+		return s.Logs(job, pod, follow)
+	}
+	return nil, ErrNoWorker
+}
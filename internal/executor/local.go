@@ -0,0 +1,189 @@
+package executor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gocraft/work"
+	"github.com/gomodule/redigo/redis"
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	"github.com/harisbeha/media-transcoder/internal/capability"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/queue"
+	log "github.com/sirupsen/logrus"
+)
+
+// Local runs transcode jobs in a worker pool inside the dispatcher process,
+// for hosts without a cluster. Jobs whose profiles require capabilities are
+// routed to the queue of a group of workers having them; others go to the
+// queue all workers take jobs from.
+type Local struct {
+	pool     *redis.Pool
+	enqueuer *work.Enqueuer
+	workers  *work.WorkerPool
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+type localContext struct{}
+
+// NewLocal creates an executor running jobs in a pool of the given size.
+func NewLocal(pool *redis.Pool, concurrency uint) *Local {
+	namespace := config.Get().TranscodeWorkerNamespace
+	workers := work.NewWorkerPool(localContext{}, concurrency, namespace, pool)
+	workers.Middleware(actions.Checkin)
+	for name, opts := range queue.PriorityJobs(config.Get().TranscodeWorkerJobName) {
+		workers.JobWithOptions(name, opts, (*localContext).run)
+	}
+
+	return &Local{
+		pool:     pool,
+		enqueuer: work.NewEnqueuer(namespace, pool),
+		workers:  workers,
+	}
+}
+
+// Run enqueues a job for a local worker able to run it. It returns
+// capability.ErrNoCapableWorker when no live worker is.
+func (l *Local) Run(job models.Job) error {
+	group, err := capability.Route(l.pool, queue.PoolTranscode, jobRequirements(job))
+	if err != nil {
+		return err
+	}
+	base := capability.JobName(config.Get().TranscodeWorkerJobName, group)
+	return queue.Enqueue(l.enqueuer, queue.JobName(base, job.Priority), job.RunAt, queue.Args(job, job.DispatchStage))
+}
+
+// Stop drops a job's queue entry. A running job stops by itself once it
+// sees it was cancelled.
+func (l *Local) Stop(job models.Job) error {
+	groups, err := capability.Groups(l.pool, queue.PoolTranscode)
+	if err != nil {
+		log.Error(err)
+	}
+	for _, group := range append([]string{""}, groups...) {
+		base := capability.JobName(config.Get().TranscodeWorkerJobName, group)
+		name := queue.JobName(base, job.Priority)
+		if err := queue.Remove(l.pool, config.Get().TranscodeWorkerNamespace, name, job.GUID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start probes the capabilities of the worker pool, advertises them, and
+// starts the pool on the shared queue and that of its group.
+func (l *Local) Start() {
+	caps := capability.Probe(queue.PoolTranscode)
+	log.Infof("executor: worker group %s, encoders %d, max resolution %dx%d, scratch %d bytes, tags %v",
+		caps.Group, len(caps.Encoders), caps.MaxWidth, caps.MaxHeight, caps.ScratchBytes, caps.Tags)
+
+	base := capability.JobName(config.Get().TranscodeWorkerJobName, caps.Group)
+	for name, opts := range queue.PriorityJobs(base) {
+		l.workers.JobWithOptions(name, opts, (*localContext).run)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.done = make(chan struct{})
+	go func() {
+		capability.Advertise(ctx, l.pool, caps)
+		close(l.done)
+	}()
+	l.workers.Start()
+}
+
+// Close withdraws the worker pool's capabilities, so no more jobs are
+// routed to it, and stops it, letting running jobs finish within the
+// shutdown grace period.
+func (l *Local) Close() {
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+	}
+	actions.StopPool(l.workers)
+}
+
+// Reroute hands the jobs queued for groups without live workers back to the
+// dispatcher, as no worker would take them otherwise.
+func (l *Local) Reroute() error {
+	namespace := config.Get().TranscodeWorkerNamespace
+	base := config.Get().TranscodeWorkerJobName
+	groups, err := capability.Groups(l.pool, queue.PoolTranscode)
+	if err != nil {
+		return err
+	}
+	live := map[string]bool{}
+	for _, group := range groups {
+		for name := range queue.PriorityJobs(capability.JobName(base, group)) {
+			live[name] = true
+		}
+	}
+
+	names, err := queue.KnownJobs(l.pool, namespace)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if live[name] || !strings.HasPrefix(name, base+"@") {
+			continue
+		}
+		jobs, err := queue.Take(l.pool, namespace, name)
+		for _, w := range jobs {
+			handBack(w)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handBack returns a job taken from the queue of a group without live
+// workers to the dispatcher.
+func handBack(w *work.Job) {
+	queued, stage := queue.JobFromArgs(w)
+	job, err := data.GetJobByGUID(queued.GUID)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	log.Infof("executor: job %s was queued for workers that are gone, rerouting", job.GUID)
+	if err := data.MarkJobPending(job.GUID, stage, job.DispatchedDate); err != nil {
+		log.Error(err)
+	}
+}
+
+// jobRequirements returns what a job needs of its worker: what its
+// profiles require, and the resolution of its source when known.
+func jobRequirements(job models.Job) capability.Requirements {
+	// The dispatched job carries no outputs or probe data.
+	j, err := data.GetJobByGUID(job.GUID)
+	if err != nil {
+		j = &job
+	}
+
+	r := capability.Require(jobProfiles(*j))
+	if probeData := storedProbeData(*j); probeData != nil {
+		for _, s := range probeData.Streams {
+			if s.CodecType == "video" && s.Disposition.AttachedPic == 0 {
+				r.Resolution(s.Width, s.Height)
+				break
+			}
+		}
+	}
+	return r
+}
+
+func (c *localContext) run(w *work.Job) error {
+	job, stage := queue.JobFromArgs(w)
+
+	// Stages retry transient failures themselves and exhausted jobs are
+	// dead-lettered, so the queue must not retry the job again.
+	if err := actions.RunEncodeJobFrom(job, stage); err != nil {
+		log.Errorf("executor: job %s failed: %v", job.GUID, err)
+	}
+	return nil
+}
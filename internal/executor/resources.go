@@ -0,0 +1,241 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	ffprobe "github.com/harisbeha/media-transcoder/internal/probe"
+	"github.com/harisbeha/media-transcoder/internal/storage"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Estimator bounds. A source is never sized below a quarter or above four
+// times its profile's resources.
+const (
+	minResourceScale = 0.25
+	maxResourceScale = 4.0
+
+	// Pixels of a 1080p frame, which profile resources are sized for.
+	referencePixels = 1920 * 1080
+)
+
+// codecScales weighs the CPU cost of decoding a source codec against H.264.
+var codecScales = map[string]float64{
+	"hevc":       1.5,
+	"vp9":        1.5,
+	"av1":        2,
+	"prores":     1.25,
+	"mpeg2video": 0.75,
+}
+
+// podResources are the CPU and memory requested for and limiting a
+// transcode worker pod.
+type podResources struct {
+	CPURequest    resource.Quantity
+	CPULimit      resource.Quantity
+	MemoryRequest resource.Quantity
+	MemoryLimit   resource.Quantity
+}
+
+// jobResources sizes the pod of a job: the largest resources of its
+// profiles, scaled by its source when the estimator is on.
+func jobResources(job models.Job) podResources {
+	var r podResources
+	for _, p := range jobProfiles(job) {
+		r = maxResources(r, profileResources(p))
+	}
+	if r.CPURequest.IsZero() && r.MemoryRequest.IsZero() {
+		r = profileResources("")
+	}
+
+	if config.Get().ResourceEstimator {
+		if probeData := storedProbeData(job); probeData != nil {
+			cpu, mem := estimateScale(probeData)
+			log.Infof("scaling resources of job %s by cpu %.2f, memory %.2f", job.GUID, cpu, mem)
+			r = r.scale(cpu, mem)
+		}
+	}
+
+	if r.CPULimit.Cmp(r.CPURequest) < 0 {
+		r.CPULimit = r.CPURequest
+	}
+	if r.MemoryLimit.Cmp(r.MemoryRequest) < 0 {
+		r.MemoryLimit = r.MemoryRequest
+	}
+	return r
+}
+
+// profileResources parses the configured resources of a profile, falling
+// back to the global resources for any that don't parse.
+func profileResources(profile string) podResources {
+	c := config.ProfileResources(profile)
+	d := config.Get().Resources
+	return podResources{
+		CPURequest:    parseQuantity(c.CPURequest, d.CPURequest),
+		CPULimit:      parseQuantity(c.CPULimit, d.CPULimit),
+		MemoryRequest: parseQuantity(c.MemoryRequest, d.MemoryRequest),
+		MemoryLimit:   parseQuantity(c.MemoryLimit, d.MemoryLimit),
+	}
+}
+
+func parseQuantity(value, fallback string) resource.Quantity {
+	q, err := resource.ParseQuantity(value)
+	if err == nil {
+		return q
+	}
+	log.Errorf("invalid resource quantity %q: %v", value, err)
+	q, err = resource.ParseQuantity(fallback)
+	if err != nil {
+		log.Errorf("invalid resource quantity %q: %v", fallback, err)
+	}
+	return q
+}
+
+func maxResources(a, b podResources) podResources {
+	max := func(x, y resource.Quantity) resource.Quantity {
+		if y.Cmp(x) > 0 {
+			return y
+		}
+		return x
+	}
+	return podResources{
+		CPURequest:    max(a.CPURequest, b.CPURequest),
+		CPULimit:      max(a.CPULimit, b.CPULimit),
+		MemoryRequest: max(a.MemoryRequest, b.MemoryRequest),
+		MemoryLimit:   max(a.MemoryLimit, b.MemoryLimit),
+	}
+}
+
+func (r podResources) scale(cpu, mem float64) podResources {
+	scaleCPU := func(q resource.Quantity) resource.Quantity {
+		return *resource.NewMilliQuantity(int64(float64(q.MilliValue())*cpu), q.Format)
+	}
+	scaleMemory := func(q resource.Quantity) resource.Quantity {
+		return *resource.NewQuantity(int64(float64(q.Value())*mem), q.Format)
+	}
+	return podResources{
+		CPURequest:    scaleCPU(r.CPURequest),
+		CPULimit:      scaleCPU(r.CPULimit),
+		MemoryRequest: scaleMemory(r.MemoryRequest),
+		MemoryLimit:   scaleMemory(r.MemoryLimit),
+	}
+}
+
+// sourceHeadBytes is how much of a gs:// source is fetched to probe it.
+// Sources whose index sits at the end don't probe from it and keep their
+// profile's resources.
+const sourceHeadBytes = 8 << 20
+
+// NeedsSourceProbe reports whether the pod of a job would be sized by probe
+// data of its source that is yet to be recorded.
+func NeedsSourceProbe(job models.Job) bool {
+	if !config.Get().ResourceEstimator || job.Action != "transcode" || storedProbeData(job) != nil {
+		return false
+	}
+	return strings.HasPrefix(job.Source, "gs://") ||
+		strings.HasPrefix(job.Source, "http://") ||
+		strings.HasPrefix(job.Source, "https://")
+}
+
+// ProbeSource probes the source of a job to size its pod with. ffprobe reads
+// http(s) sources itself; gs:// sources are probed from their first
+// sourceHeadBytes.
+func ProbeSource(ctx context.Context, job models.Job) (*ffprobe.FFProbeResponse, error) {
+	input := job.Source
+	if strings.HasPrefix(job.Source, "gs://") {
+		head, err := storage.ReadHead(ctx, job.Source, sourceHeadBytes)
+		if err != nil {
+			return nil, err
+		}
+		f, err := ioutil.TempFile("", "source-"+job.GUID+"-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(head)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		input = f.Name()
+	}
+
+	probeData, err := ffprobe.FFProbe{}.ProbeContext(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(probeData.Streams) == 0 {
+		return nil, errors.New("no streams found")
+	}
+	return probeData, nil
+}
+
+// storedProbeData returns the probe data recorded for a job's source, by an
+// earlier run or by the dispatcher before releasing it, if any.
+func storedProbeData(job models.Job) *ffprobe.FFProbeResponse {
+	if !job.Data.Valid {
+		return nil
+	}
+	probeData := &ffprobe.FFProbeResponse{}
+	if err := json.Unmarshal([]byte(job.Data.String), probeData); err != nil || len(probeData.Streams) == 0 {
+		return nil
+	}
+	return probeData
+}
+
+// estimateScale derives how much to scale a job's CPU and memory by from
+// its source: by frame size against 1080p, by decode cost of the video
+// codec, and up for long sources. Audio-only sources get a quarter.
+func estimateScale(probeData *ffprobe.FFProbeResponse) (cpu, mem float64) {
+	var video *ffprobe.Stream
+	for i, s := range probeData.Streams {
+		if s.CodecType == "video" && s.Disposition.AttachedPic == 0 {
+			video = &probeData.Streams[i]
+			break
+		}
+	}
+	if video == nil {
+		return minResourceScale, minResourceScale
+	}
+
+	pixels := float64(video.Width * video.Height)
+	if pixels == 0 {
+		pixels = referencePixels
+	}
+	cpu = pixels / referencePixels
+	mem = cpu
+
+	if s, ok := codecScales[video.CodecName]; ok {
+		cpu *= s
+	}
+
+	duration, _ := strconv.ParseFloat(probeData.Format.Duration, 64)
+	switch {
+	case duration > 2*60*60:
+		cpu *= 1.5
+		mem *= 1.5
+	case duration > 30*60:
+		cpu *= 1.25
+		mem *= 1.25
+	}
+
+	return clampScale(cpu), clampScale(mem)
+}
+
+func clampScale(f float64) float64 {
+	if f < minResourceScale {
+		return minResourceScale
+	}
+	if f > maxResourceScale {
+		return maxResourceScale
+	}
+	return f
+}
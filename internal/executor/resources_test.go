@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"testing"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	ffprobe "github.com/harisbeha/media-transcoder/internal/probe"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func probeResponse(duration string, streams ...ffprobe.Stream) *ffprobe.FFProbeResponse {
+	return &ffprobe.FFProbeResponse{Streams: streams, Format: ffprobe.Format{Duration: duration}}
+}
+
+func TestEstimateScale(t *testing.T) {
+	h264 := func(width, height int) ffprobe.Stream {
+		return ffprobe.Stream{CodecType: "video", CodecName: "h264", Width: width, Height: height}
+	}
+	audio := ffprobe.Stream{CodecType: "audio", CodecName: "aac"}
+	cover := ffprobe.Stream{CodecType: "video", CodecName: "mjpeg", Width: 3840, Height: 2160,
+		Disposition: ffprobe.Disposition{AttachedPic: 1}}
+
+	tests := []struct {
+		name     string
+		probe    *ffprobe.FFProbeResponse
+		cpu, mem float64
+	}{
+		{"1080p h264", probeResponse("60", h264(1920, 1080), audio), 1, 1},
+		{"720p h264", probeResponse("60", h264(1280, 720)), 0.4444, 0.4444},
+		{"4k hevc", probeResponse("60", ffprobe.Stream{CodecType: "video", CodecName: "hevc", Width: 3840, Height: 2160}), 4, 4},
+		{"1080p av1", probeResponse("60", ffprobe.Stream{CodecType: "video", CodecName: "av1", Width: 1920, Height: 1080}), 2, 1},
+		{"long source", probeResponse("3600", h264(1920, 1080)), 1.25, 1.25},
+		{"very long source", probeResponse("10800", h264(1920, 1080)), 1.5, 1.5},
+		{"tiny frame", probeResponse("60", h264(320, 180)), minResourceScale, minResourceScale},
+		{"unknown frame size", probeResponse("", h264(0, 0)), 1, 1},
+		{"audio only", probeResponse("60", audio), minResourceScale, minResourceScale},
+		{"cover art only", probeResponse("60", audio, cover), minResourceScale, minResourceScale},
+	}
+	for _, tt := range tests {
+		cpu, mem := estimateScale(tt.probe)
+		if !near(cpu, tt.cpu) || !near(mem, tt.mem) {
+			t.Errorf("%s: estimateScale = %.4f, %.4f, want %.4f, %.4f", tt.name, cpu, mem, tt.cpu, tt.mem)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 0.0001 && d > -0.0001
+}
+
+func TestPodResourcesScale(t *testing.T) {
+	r := podResources{
+		CPURequest:    resource.MustParse("500m"),
+		CPULimit:      resource.MustParse("1"),
+		MemoryRequest: resource.MustParse("1Gi"),
+		MemoryLimit:   resource.MustParse("2Gi"),
+	}.scale(1.5, 0.5)
+
+	for name, tt := range map[string]struct {
+		got  resource.Quantity
+		want string
+	}{
+		"cpu request":    {r.CPURequest, "750m"},
+		"cpu limit":      {r.CPULimit, "1500m"},
+		"memory request": {r.MemoryRequest, "512Mi"},
+		"memory limit":   {r.MemoryLimit, "1Gi"},
+	} {
+		if want := resource.MustParse(tt.want); tt.got.Cmp(want) != 0 {
+			t.Errorf("%s = %s, want %s", name, tt.got.String(), tt.want)
+		}
+	}
+}
+
+func TestNeedsSourceProbe(t *testing.T) {
+	defer func(on bool) { config.C.ResourceEstimator = on }(config.C.ResourceEstimator)
+	config.C.ResourceEstimator = true
+
+	probed := models.Job{Action: "transcode", Source: "gs://bucket/a.mp4"}
+	probed.Data.String, probed.Data.Valid = `{"streams":[{"codec_type":"video"}]}`, true
+
+	tests := []struct {
+		name string
+		job  models.Job
+		want bool
+	}{
+		{"gs source", models.Job{Action: "transcode", Source: "gs://bucket/a.mp4"}, true},
+		{"http source", models.Job{Action: "transcode", Source: "https://example.com/a.mp4"}, true},
+		{"local source", models.Job{Action: "transcode", Source: "/src/a.mp4"}, false},
+		{"download job", models.Job{Action: "download", Source: "gs://bucket/a.mp4"}, false},
+		{"already probed", probed, false},
+	}
+	for _, tt := range tests {
+		if got := NeedsSourceProbe(tt.job); got != tt.want {
+			t.Errorf("%s: NeedsSourceProbe = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	config.C.ResourceEstimator = false
+	if NeedsSourceProbe(models.Job{Action: "transcode", Source: "gs://bucket/a.mp4"}) {
+		t.Error("NeedsSourceProbe with the estimator off = true")
+	}
+}
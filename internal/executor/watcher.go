@@ -0,0 +1,187 @@
+package executor
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	data "github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/kube"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchResync is how often the watcher revisits every Job and pod, catching
+// up on events it may have missed.
+const watchResync = 5 * time.Minute
+
+// Watcher reconciles job statuses with the Kubernetes Jobs and pods running
+// them. Workers that die without recording why, such as OOMKilled or
+// evicted pods, would otherwise leave their jobs stuck mid-pipeline.
+type Watcher struct {
+	clientset kubernetes.Interface
+	namespace string
+	factory   informers.SharedInformerFactory
+	jobs      batchlisters.JobLister
+	stop      chan struct{}
+
+	mu   sync.Mutex
+	pods map[string]string
+}
+
+// NewWatcher creates a watcher over the Jobs and pods labelled with a job
+// GUID in the given namespace.
+func NewWatcher(clientset kubernetes.Interface, namespace string) *Watcher {
+	w := &Watcher{
+		clientset: clientset,
+		namespace: namespace,
+		pods:      map[string]string{},
+	}
+	w.factory = informers.NewSharedInformerFactoryWithOptions(clientset, watchResync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = kube.LabelJobGUID
+		}),
+	)
+
+	w.jobs = w.factory.Batch().V1().Jobs().Lister()
+	w.factory.Batch().V1().Jobs().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.onJob,
+		UpdateFunc: func(_, obj interface{}) { w.onJob(obj) },
+	})
+	w.factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.onPod,
+		UpdateFunc: func(_, obj interface{}) { w.onPod(obj) },
+	})
+	return w
+}
+
+// Start starts watching.
+func (w *Watcher) Start() {
+	w.stop = make(chan struct{})
+	w.factory.Start(w.stop)
+	w.factory.WaitForCacheSync(w.stop)
+}
+
+// Close stops watching.
+func (w *Watcher) Close() {
+	if w.stop != nil {
+		close(w.stop)
+	}
+}
+
+func (w *Watcher) onJob(obj interface{}) {
+	kubeJob, ok := obj.(*batchv1.Job)
+	if !ok {
+		return
+	}
+	guid := kubeJob.Labels[kube.LabelJobGUID]
+	if guid == "" || !w.isCurrent(guid, kubeJob.Name) {
+		return
+	}
+
+	dispatched := kubeJob.Annotations[kube.AnnotationDispatchedDate]
+	if reason := kube.JobFailure(kubeJob); reason != "" {
+		w.fail(guid, dispatched, reason)
+		return
+	}
+	// A worker records the outcome of its job before exiting, so a job left
+	// unfinished by a completed Kubernetes Job lost its worker.
+	if kube.JobComplete(kubeJob) {
+		w.fail(guid, dispatched, "worker exited before finishing the job")
+	}
+}
+
+func (w *Watcher) onPod(obj interface{}) {
+	pod, ok := obj.(*apiv1.Pod)
+	if !ok {
+		return
+	}
+	guid := pod.Labels[kube.LabelJobGUID]
+	if guid == "" || !w.isCurrent(guid, pod.Labels["job-name"]) {
+		return
+	}
+
+	w.recordPod(guid, pod.Name)
+
+	if reason := kube.PodFailure(pod); reason != "" {
+		if !w.fail(guid, pod.Annotations[kube.AnnotationDispatchedDate], pod.Name+": "+reason) {
+			return
+		}
+		// The Job would only start another pod against a failed job.
+		if err := kube.DeleteJobs(w.clientset, w.namespace, guid); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// isCurrent reports whether a Kubernetes Job is the latest one started for
+// a job. Jobs left over from earlier runs of a retried job are ignored.
+func (w *Watcher) isCurrent(guid, name string) bool {
+	selector := labels.SelectorFromSet(labels.Set{kube.LabelJobGUID: guid})
+	kubeJobs, err := w.jobs.Jobs(w.namespace).List(selector)
+	if err != nil || len(kubeJobs) == 0 {
+		return true
+	}
+	latest := kubeJobs[0]
+	for _, j := range kubeJobs[1:] {
+		if latest.CreationTimestamp.Before(&j.CreationTimestamp) {
+			latest = j
+		}
+	}
+	return latest.Name == name
+}
+
+// recordPod stores the name of the pod running a job when it changes.
+func (w *Watcher) recordPod(guid, pod string) {
+	w.mu.Lock()
+	seen := w.pods[guid] == pod
+	w.pods[guid] = pod
+	w.mu.Unlock()
+
+	if seen {
+		return
+	}
+	if err := data.SetJobPodName(guid, pod); err != nil {
+		log.Error(err)
+	}
+}
+
+// fail marks a job as errored for reason, unless it already finished. It
+// leaves the job alone and reports false when the Kubernetes Job is not
+// running the job's current dispatch, given by the dispatch date it was
+// created for: the job's worker handed it back, or it was reaped, and it
+// awaits or has had another run.
+func (w *Watcher) fail(guid, dispatched, reason string) bool {
+	job, err := data.GetJobByGUID(guid)
+	if err != nil {
+		return false
+	}
+	if awaitsDispatch(*job) || (dispatched != "" && dispatched != job.DispatchedDate.String) {
+		return false
+	}
+	if !models.CanTransition(job.Status, models.JobError) {
+		w.mu.Lock()
+		delete(w.pods, guid)
+		w.mu.Unlock()
+		return true
+	}
+	log.Warnf("watcher: job %s failed: %s", guid, reason)
+	actions.FailJob(*job, errors.New(reason))
+	return true
+}
+
+// awaitsDispatch reports whether a job was handed back to the dispatcher
+// to be run again.
+func awaitsDispatch(job models.Job) bool {
+	return !job.DispatchedDate.Valid && (job.Status == models.JobQueued || job.Status == models.JobRetrying)
+}
@@ -1,11 +1,15 @@
 package helpers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"errors"
+	"io"
 	"os"
 	"path"
 	"math"
+	"time"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -92,4 +96,52 @@ func FileExists(filename string) error {
 		return errors.New(filename + "is a directory")
 	}
 	return nil
-}
\ No newline at end of file
+}
+// WorkerID returns an identifier for the running process, used to attribute
+// job events. Inside Kubernetes this is the pod name.
+func WorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+// FileChecksum returns the hex encoded SHA-256 digest of a file.
+func FileChecksum(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParseRunAt returns when a job should run, from either an RFC 3339 time or
+// a delay such as "90m". It returns nil when neither is set.
+func ParseRunAt(runAt string, delay string) (*time.Time, error) {
+	if runAt != "" && delay != "" {
+		return nil, errors.New("run_at and delay are mutually exclusive")
+	}
+	if runAt != "" {
+		t, err := time.Parse(time.RFC3339, runAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid run_at: %v", err)
+		}
+		return &t, nil
+	}
+	if delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid delay: %q", delay)
+		}
+		t := time.Now().Add(d)
+		return &t, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,59 @@
+package intake
+
+import (
+	"context"
+	"time"
+)
+
+const channelRetryDelay = 10 * time.Second
+
+// ChannelSource is an in-process Source fed through Submit, for tests. It
+// can't be selected in config, as no producer shares a process with the
+// dispatcher. Messages are not
+// persisted; a nacked message is queued again after a delay.
+type ChannelSource struct {
+	ch         chan []byte
+	retryDelay time.Duration
+}
+
+// NewChannelSource creates a channel source buffering up to size messages.
+func NewChannelSource(size int) *ChannelSource {
+	return &ChannelSource{ch: make(chan []byte, size), retryDelay: channelRetryDelay}
+}
+
+// Submit queues a request, blocking while the buffer is full.
+func (s *ChannelSource) Submit(data []byte) {
+	s.ch <- data
+}
+
+// Receive implements Source.
+func (s *ChannelSource) Receive(ctx context.Context, handle Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data := <-s.ch:
+			handle(ctx, &channelMessage{source: s, data: data})
+		}
+	}
+}
+
+// Close implements Source.
+func (s *ChannelSource) Close() error {
+	return nil
+}
+
+type channelMessage struct {
+	source *ChannelSource
+	data   []byte
+}
+
+func (m *channelMessage) Data() []byte { return m.data }
+
+func (m *channelMessage) Ack() {}
+
+func (m *channelMessage) Nack() {
+	time.AfterFunc(m.source.retryDelay, func() {
+		m.source.Submit(m.data)
+	})
+}
@@ -0,0 +1,49 @@
+package intake
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChannelSource(t *testing.T) {
+	s := NewChannelSource(1)
+	s.retryDelay = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.Submit([]byte(`{"c24_job_id": "42"}`))
+
+	// The first delivery is nacked, the redelivery acked.
+	deliveries := 0
+	var nacked time.Time
+	err := s.Receive(ctx, func(ctx context.Context, msg Message) {
+		deliveries++
+		if got := string(msg.Data()); got != `{"c24_job_id": "42"}` {
+			t.Errorf("data = %s", got)
+		}
+		if deliveries == 1 {
+			nacked = time.Now()
+			msg.Nack()
+			return
+		}
+		if waited := time.Since(nacked); waited < s.retryDelay {
+			t.Errorf("redelivered after %s, want at least %s", waited, s.retryDelay)
+		}
+		msg.Ack()
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Errorf("Receive = %v, want context.Canceled", err)
+	}
+	if deliveries != 2 {
+		t.Errorf("deliveries = %d, want 2", deliveries)
+	}
+}
+
+func TestNewUnknownSource(t *testing.T) {
+	// The channel source has no producer outside the process embedding it.
+	if _, err := New(context.Background(), Config{Type: "channel"}, nil); err == nil {
+		t.Error("New accepted the channel intake source")
+	}
+}
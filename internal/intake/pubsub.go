@@ -0,0 +1,127 @@
+package intake
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// PubsubSource receives job requests from a Google Pub/Sub subscription of
+// the configured project. Setting PUBSUB_EMULATOR_HOST points it at the
+// Pub/Sub emulator.
+type PubsubSource struct {
+	topic        *pubsub.Topic
+	subscription *pubsub.Subscription
+}
+
+// NewPubsubSource connects to Pub/Sub, creating the topic and subscription
+// if they don't exist.
+func NewPubsubSource(ctx context.Context, topicName, subscriptionName string) (*PubsubSource, error) {
+	client, err := config.PubsubClient(ctx)
+	if err != nil {
+		log.Printf("Error when creating pubsub client. Err: %v", err)
+		return nil, err
+	}
+
+	topic, err := createTopic(ctx, client, topicName)
+	if err != nil {
+		return nil, err
+	}
+	subscription, err := createSubscription(ctx, client, subscriptionName, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.ReceiveSettings = pubsub.ReceiveSettings{
+		// This is the maximum amount of messages that are allowed to be processed by the callback function at a time.
+		// Once this limit is reached, the client waits for messages to be acked or nacked by the callback before
+		// requesting more messages from the server.
+		MaxOutstandingMessages: 100,
+		// This is the maximum amount of time that the client will extend a message's deadline. This value should be
+		// set as high as messages are expected to be processed, plus some buffer.
+		MaxExtension: 10 * time.Second,
+	}
+
+	return &PubsubSource{
+		topic:        topic,
+		subscription: subscription,
+	}, nil
+}
+
+// Receive implements Source.
+func (s *PubsubSource) Receive(ctx context.Context, handle Handler) error {
+	log.Printf("Starting a Subscriber on topic %s", s.topic.String())
+	return s.subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		handle(ctx, pubsubMessage{msg})
+	})
+}
+
+// Close implements Source. The Pub/Sub client is shared with the rest of
+// the process and stays open.
+func (s *PubsubSource) Close() error {
+	s.topic.Stop()
+	return nil
+}
+
+type pubsubMessage struct {
+	msg *pubsub.Message
+}
+
+func (m pubsubMessage) Data() []byte { return m.msg.Data }
+
+func (m pubsubMessage) Ack() { m.msg.Ack() }
+
+func (m pubsubMessage) Nack() { m.msg.Nack() }
+
+// createTopic creates a topic if a topic name does not exist or returns one
+// if it is already present
+func createTopic(ctx context.Context, client *pubsub.Client, topicName string) (*pubsub.Topic, error) {
+	topic := client.Topic(topicName)
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		log.Printf("Could not check if topic exists. Error: %+v", err)
+		return nil, err
+	}
+	if exists {
+		return topic, nil
+	}
+
+	topic, err = client.CreateTopic(ctx, topicName)
+	if err != nil {
+		log.Printf("Could not create topic. Err: %+v", err)
+		return nil, err
+	}
+	return topic, nil
+}
+
+// createSubscription creates the subscription to a topic
+func createSubscription(ctx context.Context, client *pubsub.Client, subscriptionName string, topic *pubsub.Topic) (*pubsub.Subscription, error) {
+	subscription := client.Subscription(subscriptionName)
+
+	exists, err := subscription.Exists(ctx)
+	if err != nil {
+		log.Printf("Could not check if subscription %s exists. Err: %v", subscriptionName, err)
+		return nil, err
+	}
+	if exists {
+		return subscription, nil
+	}
+
+	cfg := pubsub.SubscriptionConfig{
+		Topic: topic,
+		// The subscriber has a configurable, limited amount of time -- known as the ackDeadline -- to acknowledge
+		// the outstanding message. Once the deadline passes, the message is no longer considered outstanding, and
+		// Cloud Pub/Sub will attempt to redeliver the message.
+		AckDeadline: 60 * time.Second,
+	}
+
+	subscription, err = client.CreateSubscription(ctx, subscriptionName, cfg)
+	if err != nil {
+		log.Printf("Could not create subscription %s. Err: %v", subscriptionName, err)
+		return nil, err
+	}
+	return subscription, nil
+}
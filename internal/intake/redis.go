@@ -0,0 +1,281 @@
+package intake
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRedisStream = "transcode-jobs"
+	defaultRedisGroup  = "dispatcher"
+	redisDataField     = "data"
+	redisReadCount     = 10
+	redisBlock         = 5 * time.Second
+	redisRetryDelay    = 10 * time.Second
+
+	// Entries another consumer left unacknowledged for redisClaimIdle are
+	// claimed, checking every redisClaimInterval, as a consumer that died
+	// comes back, if at all, under another name.
+	redisClaimIdle     = time.Minute
+	redisClaimInterval = 30 * time.Second
+	redisClaimPages    = 10
+)
+
+// RedisSource receives job requests from a Redis stream through a consumer
+// group. Producers add entries with a "data" field holding the request:
+//
+//	XADD transcode-jobs * data '{"c24_job_id": "..."}'
+//
+// Entries that were read but never acknowledged are delivered again when
+// the source starts, and some time after a message is nacked. Entries other
+// consumers of the group left unacknowledged for a while are claimed and
+// delivered too.
+type RedisSource struct {
+	pool     *redis.Pool
+	stream   string
+	group    string
+	consumer string
+	pending  int32
+	retryAt  int64 // Unix nanoseconds from which pending entries are re-read.
+}
+
+// NewRedisSource creates the consumer group if needed and returns a source
+// reading from it.
+func NewRedisSource(pool *redis.Pool, stream, group, consumer string) (*RedisSource, error) {
+	if stream == "" {
+		stream = defaultRedisStream
+	}
+	if group == "" {
+		group = defaultRedisGroup
+	}
+	if consumer == "" {
+		consumer, _ = os.Hostname()
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("XGROUP", "CREATE", stream, group, "$", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+
+	return &RedisSource{
+		pool:     pool,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+		pending:  1,
+	}, nil
+}
+
+// Receive implements Source.
+func (s *RedisSource) Receive(ctx context.Context, handle Handler) error {
+	log.Printf("Starting a Subscriber on stream %s", s.stream)
+
+	cursor := ">"
+	var claimedAt time.Time
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if time.Since(claimedAt) >= redisClaimInterval {
+			claimedAt = time.Now()
+			entries, err := s.claim()
+			if err != nil {
+				log.Errorf("intake: failed to claim idle entries: %v", err)
+			}
+			for _, e := range entries {
+				handle(ctx, &redisMessage{source: s, id: e.id, data: e.data})
+			}
+		}
+
+		// Switch to re-reading this consumer's unacknowledged entries once
+		// the retry delay of the last nack passed, waiting for new entries
+		// no longer than that.
+		block := redisBlock
+		if cursor == ">" && atomic.LoadInt32(&s.pending) == 1 {
+			wait := time.Until(time.Unix(0, atomic.LoadInt64(&s.retryAt)))
+			if wait <= 0 && atomic.CompareAndSwapInt32(&s.pending, 1, 0) {
+				cursor = "0"
+			} else if wait < block {
+				block = wait
+			}
+		}
+
+		entries, err := s.read(cursor, block)
+		if err != nil {
+			return err
+		}
+		if cursor != ">" {
+			if len(entries) == 0 {
+				cursor = ">"
+				continue
+			}
+			cursor = entries[len(entries)-1].id
+		}
+
+		for _, e := range entries {
+			handle(ctx, &redisMessage{source: s, id: e.id, data: e.data})
+		}
+	}
+}
+
+// Close implements Source.
+func (s *RedisSource) Close() error {
+	return nil
+}
+
+type streamEntry struct {
+	id   string
+	data []byte
+}
+
+func (s *RedisSource) read(cursor string, block time.Duration) ([]streamEntry, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{"GROUP", s.group, s.consumer, "COUNT", redisReadCount}
+	if cursor == ">" {
+		// BLOCK 0 waits forever.
+		ms := int64(block / time.Millisecond)
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "BLOCK", ms)
+	}
+	args = append(args, "STREAMS", s.stream, cursor)
+
+	reply, err := redis.Values(conn.Do("XREADGROUP", args...))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []streamEntry
+	for _, stream := range reply {
+		// [stream, [[id, [field, value, ...]], ...]]
+		parts, err := redis.Values(stream, nil)
+		if err != nil || len(parts) != 2 {
+			continue
+		}
+		items, _ := redis.Values(parts[1], nil)
+		entries = append(entries, parseEntries(items)...)
+	}
+	return entries, nil
+}
+
+// claim takes over the entries other consumers of the group left
+// unacknowledged for at least redisClaimIdle, and returns them.
+func (s *RedisSource) claim() ([]streamEntry, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	minIdle := int64(redisClaimIdle / time.Millisecond)
+	var entries []streamEntry
+	start := "-"
+	for page := 0; page < redisClaimPages; page++ {
+		// [[id, consumer, idle ms, deliveries], ...]
+		reply, err := redis.Values(conn.Do("XPENDING", s.stream, s.group, start, "+", redisReadCount*10))
+		if err != nil {
+			return entries, err
+		}
+		if len(reply) == 0 {
+			break
+		}
+
+		ids := []interface{}{}
+		last := ""
+		for _, p := range reply {
+			info, err := redis.Values(p, nil)
+			if err != nil || len(info) != 4 {
+				continue
+			}
+			id, _ := redis.String(info[0], nil)
+			consumer, _ := redis.String(info[1], nil)
+			idle, _ := redis.Int64(info[2], nil)
+			last = id
+			if consumer != s.consumer && idle >= minIdle {
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) > 0 {
+			args := append([]interface{}{s.stream, s.group, s.consumer, minIdle}, ids...)
+			items, err := redis.Values(conn.Do("XCLAIM", args...))
+			if err != nil {
+				return entries, err
+			}
+			claimed := parseEntries(items)
+			if len(claimed) > 0 {
+				log.Infof("intake: claimed %d idle entries of other consumers", len(claimed))
+			}
+			entries = append(entries, claimed...)
+		}
+
+		if last == "" || len(reply) < redisReadCount*10 {
+			break
+		}
+		start = nextStreamID(last)
+	}
+	return entries, nil
+}
+
+// parseEntries reads stream entries, [[id, [field, value, ...]], ...],
+// skipping ones that were deleted.
+func parseEntries(items []interface{}) []streamEntry {
+	var entries []streamEntry
+	for _, item := range items {
+		kv, err := redis.Values(item, nil)
+		if err != nil || len(kv) != 2 {
+			continue
+		}
+		id, _ := redis.String(kv[0], nil)
+		fields, _ := redis.StringMap(kv[1], nil)
+		entries = append(entries, streamEntry{id: id, data: []byte(fields[redisDataField])})
+	}
+	return entries
+}
+
+// nextStreamID returns the stream entry ID following id.
+func nextStreamID(id string) string {
+	i := strings.IndexByte(id, '-')
+	if i < 0 {
+		return id
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return id
+	}
+	return id[:i+1] + strconv.FormatUint(seq+1, 10)
+}
+
+type redisMessage struct {
+	source *RedisSource
+	id     string
+	data   []byte
+}
+
+func (m *redisMessage) Data() []byte { return m.data }
+
+func (m *redisMessage) Ack() {
+	conn := m.source.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("XACK", m.source.stream, m.source.group, m.id); err != nil {
+		log.Errorf("intake: failed to ack %s: %v", m.id, err)
+	}
+}
+
+func (m *redisMessage) Nack() {
+	atomic.StoreInt64(&m.source.retryAt, time.Now().Add(redisRetryDelay).UnixNano())
+	atomic.StoreInt32(&m.source.pending, 1)
+}
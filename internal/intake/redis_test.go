@@ -0,0 +1,32 @@
+package intake
+
+import "testing"
+
+func TestNextStreamID(t *testing.T) {
+	tests := []struct {
+		id, want string
+	}{
+		{"1526985054069-0", "1526985054069-1"},
+		{"1526985054069-9", "1526985054069-10"},
+		{"bogus", "bogus"},
+	}
+	for _, tt := range tests {
+		if got := nextStreamID(tt.id); got != tt.want {
+			t.Errorf("nextStreamID(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	items := []interface{}{
+		[]interface{}{[]byte("1-0"), []interface{}{[]byte("data"), []byte(`{"c24_job_id": "42"}`)}},
+		nil, // deleted while pending
+	}
+	entries := parseEntries(items)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if entries[0].id != "1-0" || string(entries[0].data) != `{"c24_job_id": "42"}` {
+		t.Errorf("entry = %s %s", entries[0].id, entries[0].data)
+	}
+}
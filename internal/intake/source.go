@@ -0,0 +1,62 @@
+package intake
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Source types.
+const (
+	SourcePubsub = "pubsub"
+	SourceRedis  = "redis"
+)
+
+// Message is a job request received from a Source.
+type Message interface {
+	// Data returns the raw request body.
+	Data() []byte
+	// Ack marks the message as handled so it is not delivered again.
+	Ack()
+	// Nack releases the message for redelivery.
+	Nack()
+}
+
+// Handler processes a single message.
+type Handler func(ctx context.Context, msg Message)
+
+// Source delivers job requests to the dispatcher.
+type Source interface {
+	// Receive calls handle for each message until ctx is cancelled or the
+	// source fails.
+	Receive(ctx context.Context, handle Handler) error
+	// Close releases the source's connections.
+	Close() error
+}
+
+// Config defines configuration for creating a Source.
+type Config struct {
+	Type string
+
+	// Pub/Sub, in the configured project.
+	PubsubTopic        string
+	PubsubSubscription string
+
+	// Redis streams.
+	RedisStream   string
+	RedisGroup    string
+	RedisConsumer string
+}
+
+// New creates the Source selected by cfg.Type. The redis pool is only used
+// by the redis source.
+func New(ctx context.Context, cfg Config, pool *redis.Pool) (Source, error) {
+	switch cfg.Type {
+	case SourcePubsub, "":
+		return NewPubsubSource(ctx, cfg.PubsubTopic, cfg.PubsubSubscription)
+	case SourceRedis:
+		return NewRedisSource(pool, cfg.RedisStream, cfg.RedisGroup, cfg.RedisConsumer)
+	}
+	return nil, fmt.Errorf("unknown intake source: %s", cfg.Type)
+}
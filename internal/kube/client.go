@@ -0,0 +1,63 @@
+package kube
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// LabelJobGUID is the label carrying the GUID of the transcoder job a
+// Kubernetes Job runs, so it can be found again to cancel or delete it.
+const LabelJobGUID = "c24-media/job-guid"
+
+// AnnotationDispatchedDate carries the dispatch date of the run of a
+// transcoder job a Kubernetes Job was created for, telling it apart from
+// Jobs of the job's earlier runs.
+const AnnotationDispatchedDate = "c24-media/dispatched-date"
+
+// NewClientset connects to the cluster the process runs in.
+func NewClientset() (kubernetes.Interface, error) {
+	conf, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(conf)
+}
+
+// DeleteJobs deletes the Kubernetes Jobs running a transcoder job, along
+// with their pods, from the given namespace.
+func DeleteJobs(clientset kubernetes.Interface, namespace, guid string) error {
+	policy := metav1.DeletePropagationBackground
+	err := clientset.BatchV1().Jobs(namespace).DeleteCollection(
+		&metav1.DeleteOptions{PropagationPolicy: &policy},
+		metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", LabelJobGUID, guid)},
+	)
+	return err
+}
+
+// JobPods lists the pods running a transcoder job in the given namespace,
+// oldest first.
+func JobPods(clientset kubernetes.Interface, namespace, guid string) ([]apiv1.Pod, error) {
+	list, err := clientset.CoreV1().Pods(namespace).List(
+		metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", LabelJobGUID, guid)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	pods := list.Items
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+	return pods, nil
+}
+
+// PodLogs streams the log of a pod's container. With follow, the stream
+// stays open until the container exits or the stream is closed.
+func PodLogs(clientset kubernetes.Interface, namespace, pod string, follow bool) (io.ReadCloser, error) {
+	return clientset.CoreV1().Pods(namespace).GetLogs(pod, &apiv1.PodLogOptions{Follow: follow}).Stream()
+}
@@ -16,6 +16,8 @@ const (
 	Name      = "transcode"
 	imageName  = "gcr.io/coresystem-171219/c24-media:initial"
 	defaultPVCName = "mpc-storage-std-claim"
+	defaultPVCVolume = "mpc-storage-std"
+	defaultPVCMountPath = "/mpc"
 	defaultCredPath = "/google-cloud.json"
 	imagePullPolicy = apiv1.PullAlways
 	defaultNamespace = "jobs"
@@ -29,9 +31,24 @@ const (
 	defaultBackoff = int32(3)
 )
 
-// New creates a synchronize job that synchronizes secrets.
+// New creates a transcode job from the default template.
 func New(options ...func(*batchv1.Job)) *batchv1.Job {
-	b := &batchv1.Job{
+	return NewFromTemplate(defaultJob(), options...)
+}
+
+// NewFromTemplate creates a transcode job from a template, which it
+// modifies. The template must have a container.
+func NewFromTemplate(b *batchv1.Job, options ...func(*batchv1.Job)) *batchv1.Job {
+	for _, opt := range options {
+		opt(b)
+	}
+	sortEnv(b.Spec.Template.Spec.Containers[0].Env)
+
+	return b
+}
+
+func defaultJob() *batchv1.Job {
+	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: defaultJobName,
 			Namespace: defaultNamespace,
@@ -58,7 +75,7 @@ func New(options ...func(*batchv1.Job)) *batchv1.Job {
 							},
 						},
 						{
-							Name:         "mpc-storage-std",
+							Name:         defaultPVCVolume,
 							VolumeSource: apiv1.VolumeSource{
 								PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{
 									ClaimName: defaultPVCName,
@@ -73,8 +90,8 @@ func New(options ...func(*batchv1.Job)) *batchv1.Job {
 							Image:			 imageName,
 							VolumeMounts: []apiv1.VolumeMount{
 								{
-									Name:      "mpc-storage-std",
-									MountPath: "/mpc",
+									Name:      defaultPVCVolume,
+									MountPath: defaultPVCMountPath,
 								},
 							},
 							Resources: apiv1.ResourceRequirements{
@@ -107,13 +124,6 @@ func New(options ...func(*batchv1.Job)) *batchv1.Job {
 			},
 		},
 	}
-
-	for _, opt := range options {
-		opt(b)
-	}
-	sortEnv(b.Spec.Template.Spec.Containers[0].Env)
-
-	return b
 }
 
 func sortEnv(env []apiv1.EnvVar) {
@@ -129,16 +139,24 @@ func WithImage(image string) func(*batchv1.Job) {
 	}
 }
 
+// WithCommandArgs configures the worker command the container runs.
 func WithCommandArgs(action string) func(*batchv1.Job) {
 	return func(b *batchv1.Job) {
-		b.Spec.Template.Spec.Containers[0].Args[0] = action
+		c := &b.Spec.Template.Spec.Containers[0]
+		if len(c.Args) == 0 {
+			c.Args = []string{action}
+			return
+		}
+		c.Args[0] = action
 	}
 }
 
-// WithImage configures the container's image.
+// WithJobName names the Job, replacing any name or generated name the
+// template gives it.
 func WithJobName(name string) func(*batchv1.Job) {
 	return func(b *batchv1.Job) {
-		b.GenerateName = name
+		b.Name = name
+		b.GenerateName = ""
 	}
 }
 
@@ -152,11 +170,7 @@ func WithTTLCleanupTime(duration int32) func(*batchv1.Job) {
 // WithJobNameEnv configures the pod to have a job name.
 func WithJobNameEnv(name string) func(*batchv1.Job) {
 	return func(b *batchv1.Job) {
-		b.Spec.Template.Spec.Containers[0].Env[0] = apiv1.EnvVar{
-			Name:      "JOB_NAME",
-			Value:     name,
-			ValueFrom: nil,
-		}
+		setEnv(b, "JOB_NAME", name)
 	}
 }
 
@@ -178,6 +192,14 @@ func WithMaxRetries(attempts string) func(*batchv1.Job) {
 	}
 }
 
+// WithTerminationGracePeriod configures how long the job's pods get to stop
+// between SIGTERM and SIGKILL.
+func WithTerminationGracePeriod(seconds int64) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		b.Spec.Template.Spec.TerminationGracePeriodSeconds = utilpointer.Int64Ptr(seconds)
+	}
+}
+
 // WithJobRetentionDuration configures how long to keep a job upon completion or failure.
 func WithJobRetentionDuration(duration string) func(*batchv1.Job) {
 	return func(b *batchv1.Job) {
@@ -185,17 +207,17 @@ func WithJobRetentionDuration(duration string) func(*batchv1.Job) {
 	}
 }
 
-// WithCPURequest configures max CPU allocated to a job.
+// WithResourceRequest configures the CPU and memory reserved for a job.
 func WithResourceRequest(cpu string, memory string) func(*batchv1.Job) {
 	return func(b *batchv1.Job) {
-		b.Spec.Template.Spec.Containers[0].Resources.Limits = map[apiv1.ResourceName]resource.Quantity{
+		b.Spec.Template.Spec.Containers[0].Resources.Requests = map[apiv1.ResourceName]resource.Quantity{
 			apiv1.ResourceMemory: resource.MustParse(memory),
 			apiv1.ResourceCPU:    resource.MustParse(cpu),
 		}
 	}
 }
 
-// WithCPURequest configures max memory allocated to a job.
+// WithResourceLimit configures the max CPU and memory allocated to a job.
 func WithResourceLimit(cpu string, memory string) func(*batchv1.Job) {
 	return func(b *batchv1.Job) {
 		b.Spec.Template.Spec.Containers[0].Resources.Limits = map[apiv1.ResourceName]resource.Quantity{
@@ -213,4 +235,139 @@ func randSeq(n int) string {
 		b[i] = letters[rand.Intn(len(letters))]
 	}
 	return string(b)
-}
\ No newline at end of file
+}
+// WithLabel configures a label on both the job and its pods.
+func WithLabel(key, value string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		if b.Labels == nil {
+			b.Labels = map[string]string{}
+		}
+		b.Labels[key] = value
+		if b.Spec.Template.Labels == nil {
+			b.Spec.Template.Labels = map[string]string{}
+		}
+		b.Spec.Template.Labels[key] = value
+	}
+}
+
+// WithImagePullPolicy configures when the container's image is pulled.
+func WithImagePullPolicy(policy string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		b.Spec.Template.Spec.Containers[0].ImagePullPolicy = apiv1.PullPolicy(policy)
+	}
+}
+
+// WithNamespace configures the namespace the job runs in.
+func WithNamespace(namespace string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		b.Namespace = namespace
+	}
+}
+
+// WithServiceAccount configures the service account the job's pods run as.
+func WithServiceAccount(name string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		b.Spec.Template.Spec.ServiceAccountName = name
+	}
+}
+
+// WithPVC configures the persistent volume claim mounted as the work
+// directory, replacing the template's claim if it has one. A claim the
+// template lacks is mounted at /mpc unless a mount path is given.
+func WithPVC(claim, mountPath string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		spec := &b.Spec.Template.Spec
+		name := defaultPVCVolume
+		found := false
+		for i, v := range spec.Volumes {
+			if v.PersistentVolumeClaim != nil {
+				spec.Volumes[i].PersistentVolumeClaim.ClaimName = claim
+				name = v.Name
+				found = true
+				break
+			}
+		}
+		if !found {
+			spec.Volumes = append(spec.Volumes, apiv1.Volume{
+				Name: name,
+				VolumeSource: apiv1.VolumeSource{
+					PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+				},
+			})
+		}
+		if mountPath == "" {
+			if found {
+				return
+			}
+			mountPath = defaultPVCMountPath
+		}
+		c := &spec.Containers[0]
+		for i, m := range c.VolumeMounts {
+			if m.Name == name {
+				c.VolumeMounts[i].MountPath = mountPath
+				return
+			}
+		}
+		c.VolumeMounts = append(c.VolumeMounts, apiv1.VolumeMount{Name: name, MountPath: mountPath})
+	}
+}
+
+// WithCredentialsPath configures where the container finds its Google
+// Cloud credentials.
+func WithCredentialsPath(path string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		setEnv(b, "GOOGLE_APPLICATION_CREDENTIALS", path)
+	}
+}
+
+// WithNodeSelector adds node labels the job's pods must be scheduled on.
+func WithNodeSelector(selector map[string]string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		spec := &b.Spec.Template.Spec
+		if spec.NodeSelector == nil {
+			spec.NodeSelector = map[string]string{}
+		}
+		for k, v := range selector {
+			spec.NodeSelector[k] = v
+		}
+	}
+}
+
+// WithTolerations adds taints the job's pods tolerate.
+func WithTolerations(tolerations []apiv1.Toleration) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		b.Spec.Template.Spec.Tolerations = append(b.Spec.Template.Spec.Tolerations, tolerations...)
+	}
+}
+
+// WithAffinity configures the scheduling affinity of the job's pods.
+func WithAffinity(affinity *apiv1.Affinity) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		b.Spec.Template.Spec.Affinity = affinity
+	}
+}
+
+// WithAnnotation configures an annotation on both the job and its pods.
+func WithAnnotation(key, value string) func(*batchv1.Job) {
+	return func(b *batchv1.Job) {
+		if b.Annotations == nil {
+			b.Annotations = map[string]string{}
+		}
+		b.Annotations[key] = value
+		if b.Spec.Template.Annotations == nil {
+			b.Spec.Template.Annotations = map[string]string{}
+		}
+		b.Spec.Template.Annotations[key] = value
+	}
+}
+
+func setEnv(b *batchv1.Job, name, value string) {
+	c := &b.Spec.Template.Spec.Containers[0]
+	for i, e := range c.Env {
+		if e.Name == name {
+			c.Env[i] = apiv1.EnvVar{Name: name, Value: value}
+			return
+		}
+	}
+	c.Env = append(c.Env, apiv1.EnvVar{Name: name, Value: value})
+}
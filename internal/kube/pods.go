@@ -1 +1,72 @@
 package kube
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// fatalWaitingReasons are container waiting reasons a pod does not recover
+// from without someone fixing the Job spec or the cluster.
+var fatalWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CrashLoopBackOff":           true,
+}
+
+// PodFailure returns why a pod failed or cannot start, such as OOMKilled,
+// Evicted or ImagePullBackOff, or "" while the pod is healthy.
+func PodFailure(pod *apiv1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil && fatalWaitingReasons[w.Reason] {
+			return describe(w.Reason, w.Message)
+		}
+	}
+
+	if pod.Status.Phase != apiv1.PodFailed {
+		return ""
+	}
+	if pod.Status.Reason != "" {
+		return describe(pod.Status.Reason, pod.Status.Message)
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 {
+			return describe(t.Reason, fmt.Sprintf("container %s exited with code %d", cs.Name, t.ExitCode))
+		}
+	}
+	return "pod failed"
+}
+
+// JobFailure returns why a Kubernetes Job failed, such as
+// BackoffLimitExceeded, or "" when it has not failed.
+func JobFailure(job *batchv1.Job) string {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == apiv1.ConditionTrue {
+			return describe(c.Reason, c.Message)
+		}
+	}
+	return ""
+}
+
+// JobComplete reports whether a Kubernetes Job ran to completion.
+func JobComplete(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobComplete && c.Status == apiv1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(reason, message string) string {
+	if message == "" {
+		return reason
+	}
+	if reason == "" {
+		return message
+	}
+	return reason + ": " + message
+}
@@ -0,0 +1,176 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Template builds the Kubernetes Jobs transcoder jobs run in: the configured
+// Job manifest, or the default one, with the configured overrides applied.
+type Template struct {
+	job       *batchv1.Job
+	options   []func(*batchv1.Job)
+	nodePools map[string][]func(*batchv1.Job)
+}
+
+// LoadTemplate loads the Job template from config, failing on a manifest or
+// override that doesn't parse so a bad config is caught on startup.
+func LoadTemplate() (*Template, error) {
+	c := config.Get().Kube
+
+	job := defaultJob()
+	if c.Template != "" {
+		b, err := ioutil.ReadFile(c.Template)
+		if err != nil {
+			return nil, err
+		}
+		job = &batchv1.Job{}
+		if err := yaml.Unmarshal(b, job); err != nil {
+			return nil, fmt.Errorf("job template %s: %v", c.Template, err)
+		}
+		if len(job.Spec.Template.Spec.Containers) == 0 {
+			return nil, fmt.Errorf("job template %s: no containers", c.Template)
+		}
+		if job.Namespace == "" {
+			job.Namespace = defaultNamespace
+		}
+	}
+
+	t := &Template{job: job, nodePools: map[string][]func(*batchv1.Job){}}
+
+	if c.Image != "" {
+		t.options = append(t.options, WithImage(c.Image))
+	}
+	if c.ImagePullPolicy != "" {
+		t.options = append(t.options, WithImagePullPolicy(c.ImagePullPolicy))
+	}
+	if c.Namespace != "" {
+		t.options = append(t.options, WithNamespace(c.Namespace))
+	}
+	if c.ServiceAccount != "" {
+		t.options = append(t.options, WithServiceAccount(c.ServiceAccount))
+	}
+	if c.PVC != "" || c.PVCMountPath != "" {
+		claim := c.PVC
+		if claim == "" {
+			claim = defaultPVCName
+		}
+		t.options = append(t.options, WithPVC(claim, c.PVCMountPath))
+	}
+	if c.CredentialsPath != "" {
+		t.options = append(t.options, WithCredentialsPath(c.CredentialsPath))
+	}
+
+	labels, err := parsePairs(c.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("job labels: %v", err)
+	}
+	for _, k := range sortedKeys(labels) {
+		t.options = append(t.options, WithLabel(k, labels[k]))
+	}
+	annotations, err := parsePairs(c.Annotations)
+	if err != nil {
+		return nil, fmt.Errorf("job annotations: %v", err)
+	}
+	for _, k := range sortedKeys(annotations) {
+		t.options = append(t.options, WithAnnotation(k, annotations[k]))
+	}
+
+	scheduling, err := schedulingOptions(c.NodeSelector, c.Tolerations, c.Affinity)
+	if err != nil {
+		return nil, err
+	}
+	t.options = append(t.options, scheduling...)
+
+	for _, pool := range config.Get().NodePools {
+		if pool.Name == "" {
+			return nil, errors.New("node pool without a name")
+		}
+		options, err := schedulingOptions(pool.NodeSelector, pool.Tolerations, pool.Affinity)
+		if err != nil {
+			return nil, fmt.Errorf("node pool %s: %v", pool.Name, err)
+		}
+		t.nodePools[pool.Name] = options
+	}
+
+	return t, nil
+}
+
+// Namespace returns the namespace the template's Jobs run in.
+func (t *Template) Namespace() string {
+	return t.New("").Namespace
+}
+
+// New creates a Job from the template, placed in the given node pool if
+// it's not empty.
+func (t *Template) New(nodePool string, options ...func(*batchv1.Job)) *batchv1.Job {
+	opts := append([]func(*batchv1.Job){}, t.options...)
+	opts = append(opts, t.nodePools[nodePool]...)
+	opts = append(opts, options...)
+	return NewFromTemplate(t.job.DeepCopy(), opts...)
+}
+
+func schedulingOptions(selector []string, tolerations []config.Toleration, affinity string) ([]func(*batchv1.Job), error) {
+	var options []func(*batchv1.Job)
+
+	nodeSelector, err := parsePairs(selector)
+	if err != nil {
+		return nil, fmt.Errorf("node selector: %v", err)
+	}
+	if len(nodeSelector) > 0 {
+		options = append(options, WithNodeSelector(nodeSelector))
+	}
+
+	if len(tolerations) > 0 {
+		ts := make([]apiv1.Toleration, len(tolerations))
+		for i, t := range tolerations {
+			ts[i] = apiv1.Toleration{
+				Key:      t.Key,
+				Operator: apiv1.TolerationOperator(t.Operator),
+				Value:    t.Value,
+				Effect:   apiv1.TaintEffect(t.Effect),
+			}
+		}
+		options = append(options, WithTolerations(ts))
+	}
+
+	if affinity != "" {
+		a := &apiv1.Affinity{}
+		if err := yaml.Unmarshal([]byte(affinity), a); err != nil {
+			return nil, fmt.Errorf("affinity: %v", err)
+		}
+		options = append(options, WithAffinity(a))
+	}
+	return options, nil
+}
+
+// parsePairs parses key=value pairs, as used for labels, annotations and
+// node selectors whose keys may contain dots.
+func parsePairs(pairs []string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, p := range pairs {
+		i := strings.Index(p, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not a key=value pair", p)
+		}
+		m[strings.TrimSpace(p[:i])] = strings.TrimSpace(p[i+1:])
+	}
+	return m, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,163 @@
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestParsePairs(t *testing.T) {
+	tests := []struct {
+		pairs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{nil, map[string]string{}, false},
+		{[]string{"app=c24-media"}, map[string]string{"app": "c24-media"}, false},
+		{[]string{"cloud.google.com/gke-spot=true", " tier = batch "}, map[string]string{"cloud.google.com/gke-spot": "true", "tier": "batch"}, false},
+		{[]string{"query=a=b"}, map[string]string{"query": "a=b"}, false},
+		{[]string{"empty="}, map[string]string{"empty": ""}, false},
+		{[]string{"novalue"}, nil, true},
+		{[]string{"=value"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePairs(tt.pairs)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePairs(%q) = %v, %v, want %v, error %v", tt.pairs, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// loadConfig loads a config file with the given contents.
+func loadConfig(t *testing.T, contents string) {
+	f := tempFile(t, "config-*.yaml", contents)
+	defer os.Remove(f)
+	config.C = config.Config{}
+	config.LoadConfig(f)
+}
+
+func tempFile(t *testing.T, pattern, contents string) string {
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadTemplate(t *testing.T) {
+	loadConfig(t, `
+kube:
+  image: example.com/transcoder:1
+  namespace: encode
+  labels:
+    - app=c24-media
+  node_selector:
+    - disktype=ssd
+node_pools:
+  - name: spot
+    node_selector:
+      - cloud.google.com/gke-spot=true
+    tolerations:
+      - key: cloud.google.com/gke-spot
+        operator: Equal
+        value: "true"
+        effect: NoSchedule
+`)
+
+	tmpl, err := LoadTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns := tmpl.Namespace(); ns != "encode" {
+		t.Errorf("namespace = %q, want encode", ns)
+	}
+
+	job := tmpl.New("")
+	if image := job.Spec.Template.Spec.Containers[0].Image; image != "example.com/transcoder:1" {
+		t.Errorf("image = %q", image)
+	}
+	if job.Labels["app"] != "c24-media" || job.Spec.Template.Labels["app"] != "c24-media" {
+		t.Errorf("labels = %v, pod labels = %v, want app=c24-media on both", job.Labels, job.Spec.Template.Labels)
+	}
+	if want := map[string]string{"disktype": "ssd"}; !reflect.DeepEqual(job.Spec.Template.Spec.NodeSelector, want) {
+		t.Errorf("node selector = %v, want %v", job.Spec.Template.Spec.NodeSelector, want)
+	}
+	if len(job.Spec.Template.Spec.Tolerations) != 0 {
+		t.Errorf("tolerations outside a node pool = %v", job.Spec.Template.Spec.Tolerations)
+	}
+
+	spot := tmpl.New("spot").Spec.Template.Spec
+	if spot.NodeSelector["cloud.google.com/gke-spot"] != "true" {
+		t.Errorf("spot node selector = %v", spot.NodeSelector)
+	}
+	want := []apiv1.Toleration{{Key: "cloud.google.com/gke-spot", Operator: apiv1.TolerationOpEqual, Value: "true", Effect: apiv1.TaintEffectNoSchedule}}
+	if !reflect.DeepEqual(spot.Tolerations, want) {
+		t.Errorf("spot tolerations = %v, want %v", spot.Tolerations, want)
+	}
+
+	// Jobs don't share the template's maps.
+	job.Labels["app"] = "changed"
+	if tmpl.New("").Labels["app"] != "c24-media" {
+		t.Error("changing a job changed the template")
+	}
+}
+
+func TestLoadTemplateManifest(t *testing.T) {
+	manifest := tempFile(t, "job-*.yaml", `
+apiVersion: batch/v1
+kind: Job
+metadata:
+  generateName: transcode-
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+        - name: worker
+          image: example.com/base:1
+`)
+	defer os.Remove(manifest)
+	loadConfig(t, "kube:\n  template: "+manifest+"\n")
+
+	tmpl, err := LoadTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := tmpl.New("")
+	if job.Namespace != defaultNamespace {
+		t.Errorf("namespace = %q, want %q", job.Namespace, defaultNamespace)
+	}
+	if c := job.Spec.Template.Spec.Containers[0]; c.Name != "worker" || c.Image != "example.com/base:1" {
+		t.Errorf("container = %s %s, want the manifest's", c.Name, c.Image)
+	}
+}
+
+func TestLoadTemplateErrors(t *testing.T) {
+	noContainers := tempFile(t, "job-*.yaml", "apiVersion: batch/v1\nkind: Job\n")
+	defer os.Remove(noContainers)
+
+	tests := []struct {
+		name, config, want string
+	}{
+		{"bad label", "kube:\n  labels:\n    - app\n", "job labels"},
+		{"bad affinity", "kube:\n  affinity: \"nodeAffinity: [\"\n", "affinity"},
+		{"unnamed node pool", "node_pools:\n  - node_selector:\n      - a=b\n", "without a name"},
+		{"missing manifest", "kube:\n  template: /nonexistent/job.yaml\n", "no such file"},
+		{"manifest without containers", "kube:\n  template: " + noContainers + "\n", "no containers"},
+	}
+	for _, tt := range tests {
+		loadConfig(t, tt.config)
+		if _, err := LoadTemplate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: LoadTemplate error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
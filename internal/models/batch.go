@@ -0,0 +1,50 @@
+package models
+
+// Batch status types, derived from the statuses of a batch's jobs.
+const (
+	BatchPending   = "pending"
+	BatchRunning   = "running"
+	BatchCompleted = "completed"
+	BatchFailed    = "failed"
+)
+
+// Batch describes a group of jobs submitted together, with the aggregate
+// progress of its jobs.
+type Batch struct {
+	ID          int64  `db:"id" json:"id"`
+	GUID        string `db:"guid" json:"guid"`
+	Name        string `db:"name" json:"name"`
+	Tenant      string `db:"tenant" json:"tenant"`
+	CreatedDate string `db:"created_date" json:"created_date"`
+
+	Status   string         `db:"-" json:"status"`
+	Total    int            `db:"-" json:"total"`
+	Counts   map[string]int `db:"-" json:"counts"`
+	Progress float64        `db:"-" json:"progress"`
+}
+
+// Summarize sets the batch's counts and derived status from the number of
+// its jobs in each status and the sum of their progress.
+func (b *Batch) Summarize(counts map[string]int, progressSum float64) {
+	b.Counts = counts
+	b.Total = 0
+	for _, n := range counts {
+		b.Total += n
+	}
+	b.Progress = 0
+	if b.Total > 0 {
+		b.Progress = progressSum / float64(b.Total)
+	}
+
+	finished := counts[JobCompleted] + counts[JobError] + counts[JobCancelled] + counts[JobRejected]
+	switch {
+	case b.Total == 0 || counts[JobQueued] == b.Total:
+		b.Status = BatchPending
+	case counts[JobCompleted] == b.Total:
+		b.Status = BatchCompleted
+	case finished == b.Total:
+		b.Status = BatchFailed
+	default:
+		b.Status = BatchRunning
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+// DeadLetter describes a job whose retries were exhausted.
+type DeadLetter struct {
+	ID           int64      `db:"id" json:"id"`
+	JobID        int64      `db:"job_id" json:"job_id"`
+	Stage        string     `db:"stage" json:"stage"`
+	Error        string     `db:"error" json:"error"`
+	Attempts     int        `db:"attempts" json:"attempts"`
+	CreatedDate  string     `db:"created_date" json:"created_date"`
+	ReplayedDate NullString `db:"replayed_date" json:"replayed_date"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// JobEvent describes a single status transition of a job.
+type JobEvent struct {
+	ID          int64  `db:"id" json:"id"`
+	JobID       int64  `db:"job_id" json:"job_id"`
+	Status      string `db:"status" json:"status"`
+	Worker      string `db:"worker" json:"worker"`
+	Message     string `db:"message" json:"message"`
+	CreatedDate string `db:"created_date" json:"created_date"`
+}
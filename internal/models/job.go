@@ -4,6 +4,11 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Job status types.
@@ -16,6 +21,9 @@ const (
 	JobUploading   = "uploading"
 	JobCompleted   = "completed"
 	JobError       = "error"
+	JobCancelled   = "cancelled"
+	JobRetrying    = "retrying"
+	JobRejected    = "rejected"
 )
 
 // JobStatuses All job status types.
@@ -28,6 +36,54 @@ var JobStatuses = []string{
 	JobUploading,
 	JobCompleted,
 	JobError,
+	JobCancelled,
+	JobRetrying,
+	JobRejected,
+}
+
+// JobTransitions maps each job status to the statuses it may move to.
+// Statuses without an entry are terminal.
+var JobTransitions = map[string][]string{
+	JobQueued:      {JobDownloading, JobProbing, JobCancelled, JobRejected, JobError},
+	JobDownloading: {JobDownloaded, JobCompleted, JobRetrying, JobCancelled, JobError},
+	JobDownloaded:  {JobProbing, JobCompleted, JobRetrying, JobCancelled, JobError},
+	JobProbing:     {JobEncoding, JobRetrying, JobCancelled, JobError},
+	JobEncoding:    {JobUploading, JobRetrying, JobCancelled, JobError},
+	JobUploading:   {JobCompleted, JobRetrying, JobCancelled, JobError},
+	JobRetrying:    {JobQueued, JobDownloading, JobProbing, JobEncoding, JobUploading, JobCancelled, JobError},
+	JobError:       {JobRetrying},
+	JobCancelled:   {JobRetrying},
+}
+
+// IsValidStatus reports whether status is a known job status.
+func IsValidStatus(status string) bool {
+	for _, s := range JobStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// CanTransition reports whether a job may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, s := range JobTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionSources returns every status a job may move to the given status from.
+func TransitionSources(to string) []string {
+	var sources []string
+	for _, from := range JobStatuses {
+		if CanTransition(from, to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
 }
 
 // Job describes the job info.
@@ -41,25 +97,95 @@ type Job struct {
 	Meta 		JobMetadata `db:"metadata" json:"metadata"`
 	Callback 	Callback `db:"callback" json:"callback"`
 	Action		string `db:"action" json:"action"`
+	IdempotencyKey string `db:"idempotency_key" json:"idempotency_key,omitempty"`
+	Tenant      string `db:"tenant" json:"tenant"`
+	Priority    string `db:"priority" json:"priority"`
+	BatchID     *int64 `db:"batch_id" json:"batch_id,omitempty"`
+
+	// Scheduling. A job waits for the dispatcher until it is released to
+	// its work queue, to be run from DispatchStage no earlier than RunAt.
+	RunAt          *time.Time `db:"run_at" json:"run_at,omitempty"`
+	DispatchStage  string     `db:"dispatch_stage" json:"-"`
+	DispatchedDate NullString `db:"dispatched_date" json:"dispatched_date"`
+	PodName        string     `db:"pod_name" json:"pod_name,omitempty"`
+
+	// Lease. A running job's worker renews its lease with heartbeats
+	// carrying its stage and progress; a job whose lease expires is
+	// reaped and requeued or failed.
+	LeaseID       NullString `db:"lease_id" json:"-"`
+	LeaseOwner    string     `db:"lease_owner" json:"lease_owner,omitempty"`
+	LeaseStage    string     `db:"lease_stage" json:"lease_stage,omitempty"`
+	LeaseProgress float64    `db:"lease_progress" json:"lease_progress,omitempty"`
+	LeaseExpires  NullString `db:"lease_expires" json:"lease_expires"`
+	HeartbeatDate NullString `db:"heartbeat_date" json:"heartbeat_date"`
+	ReapedCount   int        `db:"reaped_count" json:"reaped_count,omitempty"`
 
 	// EncodeData.
 	EncodeData `db:"transcode"`
 
+	// Outputs.
+	Outputs []JobOutput `db:"-" json:"outputs,omitempty"`
+
 	Source           string `db:"source" json:"source,omitempty"`
 	Destination      string `db:"destination" json:"destination,omitempty"`
 	LocalSource      string `json:"local_source,omitempty"`
 	LocalDestination string `json:"local_destination,omitempty"`
 }
 
+// IdempotencyKey derives the key identifying repeated submissions of the
+// same job: its c24_job_id, action and the sorted profiles of its outputs.
+func IdempotencyKey(c24JobID, action string, outputs []JobOutput) string {
+	profiles := make([]string, 0, len(outputs))
+	for _, o := range outputs {
+		profiles = append(profiles, o.Profile)
+	}
+	sort.Strings(profiles)
+	return fmt.Sprintf("%s:%s:%s", c24JobID, action, strings.Join(profiles, ","))
+}
+
+// JobMetadata holds arbitrary requester supplied data echoed back with the job.
 type JobMetadata map[string]interface{}
-type Callback map[string]interface{}
-
-//type Callback struct {
-//	Method       string `json:"method"`
-//	Action       string `json:"action"`
-//	Topic        string `json:"topic"`
-//	Subscription string `json:"subscription"`
-//}
+
+// Callback describes how the requester of a job wants to be notified.
+// Webhooks are sent with Method, POST or PUT, defaulting to POST. Events
+// limits webhooks to the listed event types; empty means all events.
+type Callback struct {
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Topic   string            `json:"topic,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Events  []string          `json:"events,omitempty"`
+}
+
+// HTTPMethod returns the method webhooks are sent with.
+func (c Callback) HTTPMethod() string {
+	if c.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(c.Method)
+}
+
+// Validate checks the callback's method is one webhooks can be sent with.
+func (c Callback) Validate() error {
+	switch c.HTTPMethod() {
+	case http.MethodPost, http.MethodPut:
+		return nil
+	}
+	return fmt.Errorf("Unsupported callback method: %s", c.Method)
+}
+
+// Wants reports whether the callback subscribes to an event type.
+func (c Callback) Wants(event string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
 
 // EncodeData describes the encode data.
 type EncodeData struct {
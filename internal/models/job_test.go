@@ -0,0 +1,57 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{JobQueued, JobDownloading, true},
+		{JobQueued, JobProbing, true},
+		{JobQueued, JobEncoding, false},
+		{JobDownloading, JobDownloaded, true},
+		{JobProbing, JobEncoding, true},
+		{JobEncoding, JobUploading, true},
+		{JobEncoding, JobCompleted, false},
+		{JobUploading, JobCompleted, true},
+		{JobRetrying, JobEncoding, true},
+		{JobError, JobRetrying, true},
+		{JobError, JobQueued, false},
+		{JobCancelled, JobRetrying, true},
+		{JobCompleted, JobRetrying, false},
+		{JobCompleted, JobError, false},
+		{JobRejected, JobRetrying, false},
+		{"bogus", JobQueued, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestJobTransitionsUseKnownStatuses(t *testing.T) {
+	for from, tos := range JobTransitions {
+		if !IsValidStatus(from) {
+			t.Errorf("transition from unknown status %q", from)
+		}
+		for _, to := range tos {
+			if !IsValidStatus(to) {
+				t.Errorf("transition from %q to unknown status %q", from, to)
+			}
+		}
+	}
+}
+
+func TestTransitionSources(t *testing.T) {
+	if got := TransitionSources(JobQueued); !reflect.DeepEqual(got, []string{JobRetrying}) {
+		t.Errorf("TransitionSources(queued) = %v, want [retrying]", got)
+	}
+	if got := TransitionSources(JobCompleted); !reflect.DeepEqual(got, []string{JobDownloading, JobDownloaded, JobUploading}) {
+		t.Errorf("TransitionSources(completed) = %v", got)
+	}
+}
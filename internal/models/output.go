@@ -0,0 +1,62 @@
+package models
+
+// Output status types.
+const (
+	OutputPending   = "pending"
+	OutputEncoding  = "encoding"
+	OutputUploading = "uploading"
+	OutputCompleted = "completed"
+	OutputError     = "error"
+)
+
+// JobOutput describes a single rendition produced by a job.
+type JobOutput struct {
+	ID          int64   `db:"id" json:"id"`
+	JobID       int64   `db:"job_id" json:"job_id"`
+	Profile     string  `db:"profile" json:"profile"`
+	URL         string  `db:"url" json:"url"`
+	Size        int64   `db:"size" json:"size"`
+	Duration    float64 `db:"duration" json:"duration"`
+	Bitrate     int64   `db:"bitrate" json:"bitrate"`
+	Checksum    string  `db:"checksum" json:"checksum"`
+	Status      string  `db:"status" json:"status"`
+	CreatedDate string  `db:"created_date" json:"created_date"`
+}
+
+// OutputSpec describes an output requested on job creation.
+type OutputSpec struct {
+	Profile     string `json:"profile"`
+	Destination string `json:"dest"`
+}
+
+// NewJobOutputs merges the single profile, the profile list and the explicit
+// output specs of a job request into pending outputs. Duplicate profiles
+// without an explicit destination are dropped.
+func NewJobOutputs(profile string, profiles []string, specs []OutputSpec) []JobOutput {
+	outputs := []JobOutput{}
+	seen := map[string]bool{}
+
+	add := func(p, dest string) {
+		if p == "" {
+			return
+		}
+		if dest == "" && seen[p] {
+			return
+		}
+		seen[p] = true
+		outputs = append(outputs, JobOutput{
+			Profile: p,
+			URL:     dest,
+			Status:  OutputPending,
+		})
+	}
+
+	add(profile, "")
+	for _, p := range profiles {
+		add(p, "")
+	}
+	for _, s := range specs {
+		add(s.Profile, s.Destination)
+	}
+	return outputs
+}
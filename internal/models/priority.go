@@ -0,0 +1,21 @@
+package models
+
+// Job priority levels.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// Priorities lists the job priority levels, highest first.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// IsValidPriority reports whether priority is a known priority level.
+func IsValidPriority(priority string) bool {
+	for _, p := range Priorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
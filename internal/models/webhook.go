@@ -0,0 +1,62 @@
+package models
+
+import "database/sql/driver"
+
+// Webhook event types.
+const (
+	WebhookJobStarted   = "job.started"
+	WebhookJobProgress  = "job.progress"
+	WebhookJobCompleted = "job.completed"
+	WebhookJobFailed    = "job.failed"
+	WebhookJobCancelled = "job.cancelled"
+)
+
+// Webhook delivery status types.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery describes a webhook sent for a job event, along with the
+// outcome of its latest attempt. Pending deliveries are attempted from
+// NextAttempt on.
+type WebhookDelivery struct {
+	ID           int64      `db:"id" json:"id"`
+	JobID        int64      `db:"job_id" json:"job_id"`
+	Event        string     `db:"event" json:"event"`
+	URL          string     `db:"url" json:"url"`
+	Payload      RawPayload `db:"payload" json:"payload"`
+	Status       string     `db:"status" json:"status"`
+	Attempts     int        `db:"attempts" json:"attempts"`
+	ResponseCode int        `db:"response_code" json:"response_code"`
+	LastError    string     `db:"last_error" json:"last_error"`
+	NextAttempt  NullString `db:"next_attempt" json:"next_attempt"`
+	CreatedDate  string     `db:"created_date" json:"created_date"`
+	UpdatedDate  string     `db:"updated_date" json:"updated_date"`
+}
+
+// RawPayload is a JSON document stored and returned verbatim.
+type RawPayload []byte
+
+// MarshalJSON for RawPayload
+func (p RawPayload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+func (p RawPayload) Value() (driver.Value, error) {
+	return []byte(p), nil
+}
+
+func (p *RawPayload) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		*p = append((*p)[:0], v...)
+	case string:
+		*p = RawPayload(v)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package encoder
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
@@ -13,38 +14,59 @@ type FFProbe struct{}
 
 // Run runs an FFProbe command.
 func (f FFProbe) Run(input string) *FFProbeResponse {
+	dat, err := f.Probe(input)
+	if err != nil {
+		panic(err)
+	}
+	return dat
+}
+
+// Probe runs an FFProbe command, returning an error instead of panicking
+// when the input can't be probed.
+func (f FFProbe) Probe(input string) (*FFProbeResponse, error) {
+	return f.ProbeContext(context.Background(), input)
+}
+
+// ProbeContext is Probe, killing ffprobe when ctx is done first.
+func (f FFProbe) ProbeContext(ctx context.Context, input string) (*FFProbeResponse, error) {
 	args := []string{
 		"-i", input,
 		"-show_streams",
+		"-show_format",
 		"-print_format", "json",
 		"-v", "quiet",
 	}
 
-	// Build args string.
-	// for _, v := range options {
-	// 	args = append(args, strings.Split(v, " ")...)
-	// }
-	// args = append(args, output)
-
 	// Execute command.
-	cmd := exec.Command(ffprobeCmd, args...)
+	cmd := exec.CommandContext(ctx, ffprobeCmd, args...)
 	fmt.Println("Running FFprobe...")
 	stdout, err := cmd.CombinedOutput()
 	if err != nil {
 		fmt.Println(err.Error())
 	}
-	// fmt.Println(string(stdout))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	// j, _ := json.Marshal(string(stdout))
 	dat := &FFProbeResponse{}
 	if err := json.Unmarshal([]byte(stdout), &dat); err != nil {
-		panic(err)
+		return nil, err
 	}
-	return dat
+	return dat, nil
 }
 
 type FFProbeResponse struct {
 	Streams []Stream `json:"streams"`
+	Format  Format   `json:"format"`
+}
+
+type Format struct {
+	Filename   string `json:"filename"`
+	NbStreams  int    `json:"nb_streams"`
+	FormatName string `json:"format_name"`
+	Duration   string `json:"duration"`
+	Size       string `json:"size"`
+	BitRate    string `json:"bit_rate"`
 }
 
 type Stream struct {
@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"sort"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Worker pools that can be drained, besides the Kubernetes node pools.
+const (
+	PoolTranscode = "transcode"
+	PoolDownload  = "download"
+)
+
+// drainKey holds the names of the pools being drained.
+const drainKey = "c24-media:draining"
+
+// Drain stops the dispatcher releasing jobs to a pool. Jobs already
+// released run to completion.
+func Drain(pool *redis.Pool, name string) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SADD", drainKey, name)
+	return err
+}
+
+// Resume lets the dispatcher release jobs to a drained pool again.
+func Resume(pool *redis.Pool, name string) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SREM", drainKey, name)
+	return err
+}
+
+// Draining lists the pools being drained.
+func Draining(pool *redis.Pool) ([]string, error) {
+	conn := pool.Get()
+	defer conn.Close()
+	names, err := redis.Strings(conn.Do("SMEMBERS", drainKey))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
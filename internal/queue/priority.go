@@ -0,0 +1,33 @@
+package queue
+
+import (
+	"github.com/gocraft/work"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+// workPriorities maps job priority levels to gocraft/work priorities, which
+// weigh how often a worker pool samples each job name.
+var workPriorities = map[string]uint{
+	models.PriorityLow:    1,
+	models.PriorityNormal: 10,
+	models.PriorityHigh:   100,
+}
+
+// JobName returns the work queue job name for a priority level. Normal
+// priority jobs keep the plain job name.
+func JobName(base, priority string) string {
+	if priority == "" || priority == models.PriorityNormal {
+		return base
+	}
+	return base + "_" + priority
+}
+
+// PriorityJobs returns the job names a worker pool registers for a job,
+// one per priority level, with their gocraft/work options.
+func PriorityJobs(base string) map[string]work.JobOptions {
+	jobs := map[string]work.JobOptions{}
+	for priority, p := range workPriorities {
+		jobs[JobName(base, priority)] = work.JobOptions{Priority: p}
+	}
+	return jobs
+}
@@ -0,0 +1,164 @@
+// Package queue holds the naming and argument conventions shared by the
+// code enqueueing jobs on gocraft/work and the workers consuming them.
+package queue
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gocraft/work"
+	"github.com/gomodule/redigo/redis"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+// Args returns the work queue arguments of a job, to be run from the given
+// pipeline stage. An empty stage runs the whole pipeline.
+func Args(job models.Job, stage string) work.Q {
+	args := work.Q{
+		"guid":        job.GUID,
+		"profile":     job.Profile,
+		"source":      job.Source,
+		"destination": job.Destination,
+		"c24_job_id":  job.C24JobID,
+		"action":      job.Action,
+	}
+	if stage != "" {
+		args["stage"] = stage
+	}
+	return args
+}
+
+// JobFromArgs reads back the job and pipeline stage a work queue job was
+// enqueued with.
+func JobFromArgs(w *work.Job) (models.Job, string) {
+	job := models.Job{
+		GUID:        w.ArgString("guid"),
+		C24JobID:    w.ArgString("c24_job_id"),
+		Profile:     w.ArgString("profile"),
+		Source:      w.ArgString("source"),
+		Destination: w.ArgString("destination"),
+		Action:      w.ArgString("action"),
+	}
+	var stage string
+	if _, ok := w.Args["stage"]; ok {
+		stage = w.ArgString("stage")
+	}
+	return job, stage
+}
+
+// Enqueue adds a job to a work queue, delayed until runAt if that is still
+// ahead.
+func Enqueue(e *work.Enqueuer, name string, runAt *time.Time, args work.Q) error {
+	if runAt != nil {
+		if delay := time.Until(*runAt); delay > 0 {
+			_, err := e.EnqueueIn(name, int64(math.Ceil(delay.Seconds())), args)
+			return err
+		}
+	}
+	_, err := e.Enqueue(name, args)
+	return err
+}
+
+// Remove drops the jobs carrying a job GUID from a work queue, and from the
+// delayed jobs of its namespace, if no worker has picked them up yet.
+func Remove(pool *redis.Pool, namespace, name, guid string) error {
+	conn := pool.Get()
+	defer conn.Close()
+
+	queueKey := redisKey(namespace, "jobs:"+name)
+	queued, err := redis.ByteSlices(conn.Do("LRANGE", queueKey, 0, -1))
+	if err != nil {
+		return err
+	}
+	for _, raw := range matchingJobs(queued, guid) {
+		if _, err := conn.Do("LREM", queueKey, 1, raw); err != nil {
+			return err
+		}
+	}
+
+	scheduledKey := redisKey(namespace, "scheduled")
+	scheduled, err := redis.ByteSlices(conn.Do("ZRANGE", scheduledKey, 0, -1))
+	if err != nil {
+		return err
+	}
+	for _, raw := range matchingJobs(scheduled, guid) {
+		if _, err := conn.Do("ZREM", scheduledKey, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KnownJobs returns the job names workers of a namespace ever registered.
+func KnownJobs(pool *redis.Pool, namespace string) ([]string, error) {
+	conn := pool.Get()
+	defer conn.Close()
+	return redis.Strings(conn.Do("SMEMBERS", redisKey(namespace, "known_jobs")))
+}
+
+// Take removes and returns the jobs waiting in a work queue.
+func Take(pool *redis.Pool, namespace, name string) ([]*work.Job, error) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	queueKey := redisKey(namespace, "jobs:"+name)
+	jobs := []*work.Job{}
+	for {
+		raw, err := redis.Bytes(conn.Do("RPOP", queueKey))
+		if err == redis.ErrNil {
+			return jobs, nil
+		}
+		if err != nil {
+			return jobs, err
+		}
+		var w work.Job
+		if err := json.Unmarshal(raw, &w); err != nil {
+			continue
+		}
+		jobs = append(jobs, &w)
+	}
+}
+
+// DeadJob returns the dead job of a namespace with the given ID that died
+// at diedAt, or nil when there is none.
+func DeadJob(pool *redis.Pool, namespace string, diedAt int64, id string) (*work.Job, error) {
+	conn := pool.Get()
+	defer conn.Close()
+
+	raws, err := redis.ByteSlices(conn.Do("ZRANGEBYSCORE", redisKey(namespace, "dead"), diedAt, diedAt))
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range raws {
+		var w work.Job
+		if err := json.Unmarshal(raw, &w); err == nil && w.ID == id {
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+// matchingJobs returns the serialized work queue jobs carrying a job GUID.
+func matchingJobs(raws [][]byte, guid string) [][]byte {
+	matches := [][]byte{}
+	for _, raw := range raws {
+		var w work.Job
+		if err := json.Unmarshal(raw, &w); err != nil {
+			continue
+		}
+		if w.ArgString("guid") == guid {
+			matches = append(matches, raw)
+		}
+	}
+	return matches
+}
+
+// redisKey returns a gocraft/work redis key within a namespace.
+func redisKey(namespace, key string) string {
+	if !strings.HasSuffix(namespace, ":") {
+		namespace += ":"
+	}
+	return namespace + key
+}
@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/gocraft/work"
+	"github.com/gomodule/redigo/redis"
+)
+
+// maxCountedJobs caps how many of the scheduled, retry and dead jobs of a
+// namespace are read to count them by job name.
+const maxCountedJobs = 1000
+
+// Stats describes a work queue: how many jobs wait in it and for how long
+// the oldest has, in seconds, and how many of its jobs are scheduled to
+// run later, waiting to be retried, or dead. Partial is set when the
+// namespace holds more scheduled, retry or dead jobs than are counted, so
+// those counts are of the newest only.
+type Stats struct {
+	Pool      string `json:"pool"`
+	Namespace string `json:"namespace"`
+	JobName   string `json:"job_name"`
+	Count     int64  `json:"count"`
+	Latency   int64  `json:"latency"`
+	Scheduled int64  `json:"scheduled"`
+	Retry     int64  `json:"retry"`
+	Dead      int64  `json:"dead"`
+	Partial   bool   `json:"partial,omitempty"`
+}
+
+// QueueStats returns the stats of the work queues of a namespace, sorted by
+// job name. Job names with no queue left but scheduled, retried or dead
+// jobs are listed too.
+func QueueStats(pool *redis.Pool, name, namespace string) ([]Stats, error) {
+	queues, err := work.NewClient(namespace, pool).Queues()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]*Stats{}
+	get := func(jobName string) *Stats {
+		if s, ok := stats[jobName]; ok {
+			return s
+		}
+		s := &Stats{Pool: name, Namespace: namespace, JobName: jobName}
+		stats[jobName] = s
+		return s
+	}
+	for _, q := range queues {
+		s := get(q.JobName)
+		s.Count, s.Latency = q.Count, q.Latency
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+	partial := false
+	for _, key := range []string{"scheduled", "retry", "dead"} {
+		total, err := redis.Int64(conn.Do("ZCARD", redisKey(namespace, key)))
+		if err != nil {
+			return nil, err
+		}
+		if total == 0 {
+			continue
+		}
+		partial = partial || total > maxCountedJobs
+		raws, err := redis.ByteSlices(conn.Do("ZREVRANGE", redisKey(namespace, key), 0, maxCountedJobs-1))
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range raws {
+			var w work.Job
+			if err := json.Unmarshal(raw, &w); err != nil {
+				continue
+			}
+			switch s := get(w.Name); key {
+			case "scheduled":
+				s.Scheduled++
+			case "retry":
+				s.Retry++
+			case "dead":
+				s.Dead++
+			}
+		}
+	}
+
+	list := make([]Stats, 0, len(stats))
+	for _, s := range stats {
+		s.Partial = partial
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].JobName < list[j].JobName })
+	return list, nil
+}
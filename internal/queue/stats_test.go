@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocraft/work"
+	"github.com/gomodule/redigo/redis"
+)
+
+// fakeRedis is an in-memory redis serving the set, list and sorted set
+// reads the work queue stats use. Lists are stored head first and sorted
+// sets lowest score first.
+type fakeRedis struct {
+	sets    map[string][]string
+	lists   map[string][][]byte
+	zsets   map[string][][]byte
+	pending []interface{}
+}
+
+func (r *fakeRedis) pool() *redis.Pool {
+	return &redis.Pool{Dial: func() (redis.Conn, error) { return r, nil }}
+}
+
+func (r *fakeRedis) Close() error { return nil }
+func (r *fakeRedis) Err() error   { return nil }
+func (r *fakeRedis) Flush() error { return nil }
+
+func (r *fakeRedis) Send(cmd string, args ...interface{}) error {
+	reply, err := r.Do(cmd, args...)
+	if err != nil {
+		return err
+	}
+	r.pending = append(r.pending, reply)
+	return nil
+}
+
+func (r *fakeRedis) Receive() (interface{}, error) {
+	if len(r.pending) == 0 {
+		return nil, fmt.Errorf("no pending reply")
+	}
+	reply := r.pending[0]
+	r.pending = r.pending[1:]
+	return reply, nil
+}
+
+func (r *fakeRedis) Do(cmd string, args ...interface{}) (interface{}, error) {
+	switch cmd {
+	case "":
+		return nil, nil
+	case "SMEMBERS":
+		var members []interface{}
+		for _, m := range r.sets[args[0].(string)] {
+			members = append(members, []byte(m))
+		}
+		return members, nil
+	case "LLEN":
+		return int64(len(r.lists[args[0].(string)])), nil
+	case "LINDEX":
+		list := r.lists[args[0].(string)]
+		if len(list) == 0 {
+			return nil, nil
+		}
+		return list[len(list)-1], nil
+	case "ZCARD":
+		return int64(len(r.zsets[args[0].(string)])), nil
+	case "ZREVRANGE":
+		zset := r.zsets[args[0].(string)]
+		start, stop := args[1].(int), args[2].(int)
+		var items []interface{}
+		for i := len(zset) - 1 - start; i >= 0 && i >= len(zset)-1-stop; i-- {
+			items = append(items, zset[i])
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unsupported command %s", cmd)
+}
+
+func rawJob(t *testing.T, name string, enqueuedAt int64) []byte {
+	b, err := json.Marshal(work.Job{Name: name, ID: fmt.Sprintf("%s-%d", name, enqueuedAt), EnqueuedAt: enqueuedAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestQueueStats(t *testing.T) {
+	now := time.Now().Unix()
+	r := &fakeRedis{
+		sets: map[string][]string{
+			"transcode:known_jobs": {"transcode", "transcode@ab12cd34"},
+		},
+		lists: map[string][][]byte{
+			"transcode:jobs:transcode": {rawJob(t, "transcode", now-5), rawJob(t, "transcode", now-60)},
+		},
+		zsets: map[string][][]byte{
+			"transcode:scheduled": {rawJob(t, "transcode", now), rawJob(t, "transcode@ab12cd34", now)},
+			"transcode:retry":     {rawJob(t, "transcode", now)},
+			"transcode:dead":      {rawJob(t, "gone@ff00ff00", now), []byte("not json")},
+		},
+	}
+
+	got, err := QueueStats(r.pool(), PoolTranscode, "transcode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("stats = %+v, want 3 job names", got)
+	}
+
+	// Latency is measured from the oldest job, at the tail of the list.
+	if got[1].Latency < 60 || got[1].Latency > 65 {
+		t.Errorf("latency = %d, want about 60", got[1].Latency)
+	}
+	got[1].Latency = 0
+
+	want := []Stats{
+		{Pool: PoolTranscode, Namespace: "transcode", JobName: "gone@ff00ff00", Dead: 1},
+		{Pool: PoolTranscode, Namespace: "transcode", JobName: "transcode", Count: 2, Scheduled: 1, Retry: 1},
+		{Pool: PoolTranscode, Namespace: "transcode", JobName: "transcode@ab12cd34", Scheduled: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestQueueStatsPartial(t *testing.T) {
+	now := time.Now().Unix()
+	dead := make([][]byte, maxCountedJobs+1)
+	for i := range dead {
+		dead[i] = rawJob(t, "transcode", now+int64(i))
+	}
+	r := &fakeRedis{zsets: map[string][][]byte{"transcode:dead": dead}}
+
+	got, err := QueueStats(r.pool(), PoolTranscode, "transcode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Dead != maxCountedJobs || !got[0].Partial {
+		t.Errorf("stats = %+v, want %d dead counted and partial", got, maxCountedJobs)
+	}
+}
@@ -0,0 +1,140 @@
+package results
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/data"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Message attributes set on every result.
+const (
+	AttrC24JobID = "c24_job_id"
+	AttrStatus   = "status"
+	AttrSequence = "sequence"
+)
+
+// Result is the message published when a job completes or fails.
+type Result struct {
+	C24JobID  string             `json:"c24_job_id"`
+	GUID      string             `json:"guid"`
+	Action    string             `json:"action"`
+	Status    string             `json:"status"`
+	Profile   string             `json:"profile"`
+	Source    string             `json:"source"`
+	Outputs   []models.JobOutput `json:"outputs"`
+	Metadata  models.JobMetadata `json:"metadata"`
+	Error     string             `json:"error,omitempty"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+var (
+	mu    sync.Mutex
+	topic *pubsub.Topic
+)
+
+// Publish sends the result of a job to the configured result topic. It is a
+// no-op when no result topic is configured.
+//
+// Results of a job may be published by different processes, and Pub/Sub
+// may deliver them out of order, so every message carries the c24_job_id
+// and a sequence number: the ID of the job's latest status event, which
+// the database hands out in transition order. Consumers must order the
+// results of a job by sequence and ignore any not newer than one already
+// handled.
+func Publish(guid string, jobErr error) error {
+	if config.Get().PubsubResultTopic == "" {
+		return nil
+	}
+
+	// Read the sequence first, so it never runs ahead of the status.
+	seq, err := data.GetLastJobEventID(guid)
+	if err != nil {
+		return err
+	}
+	job, err := data.GetJobByGUID(guid)
+	if err != nil {
+		return err
+	}
+
+	r := Result{
+		C24JobID:  job.C24JobID,
+		GUID:      job.GUID,
+		Action:    job.Action,
+		Status:    job.Status,
+		Profile:   job.Profile,
+		Source:    job.Source,
+		Outputs:   job.Outputs,
+		Metadata:  job.Meta,
+		Timestamp: time.Now().UTC(),
+	}
+	if jobErr != nil {
+		r.Error = jobErr.Error()
+	}
+	if r.Outputs == nil {
+		r.Outputs = []models.JobOutput{}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	ctx := context.Background()
+	t, err := getTopic(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := t.Publish(ctx, &pubsub.Message{
+		Data: b,
+		Attributes: map[string]string{
+			AttrC24JobID: r.C24JobID,
+			AttrStatus:   r.Status,
+			AttrSequence: strconv.FormatInt(seq, 10),
+		},
+	}).Get(ctx)
+	if err != nil {
+		return err
+	}
+	log.Infof("results: published %s for job %s as %s", r.Status, r.C24JobID, id)
+	return nil
+}
+
+// getTopic returns the result topic, creating it if it doesn't exist.
+// PUBSUB_EMULATOR_HOST is honoured by the client.
+func getTopic(ctx context.Context) (*pubsub.Topic, error) {
+	if topic != nil {
+		return topic, nil
+	}
+
+	c, err := config.PubsubClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := config.Get().PubsubResultTopic
+	t := c.Topic(name)
+	exists, err := t.Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if t, err = c.CreateTopic(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	topic = t
+	return topic, nil
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/harisbeha/media-transcoder/internal/dispatch"
+	"github.com/labstack/echo/v4"
+)
+
+func getDrainHandler(c echo.Context) error {
+	pools, err := dispatcher.Draining()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, H{
+		"status": http.StatusOK,
+		"pools":  pools,
+	})
+}
+
+// drainPoolHandler stops the dispatcher releasing jobs to a worker or node
+// pool, ahead of maintenance. Its running jobs carry on; the pool reports
+// drained once they are done.
+func drainPoolHandler(c echo.Context) error {
+	pool := c.Param("pool")
+	if !dispatch.IsValidPool(pool) {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": "Unknown pool: " + pool,
+		})
+	}
+	if err := dispatcher.Drain(pool); err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Draining pool " + pool,
+	})
+}
+
+func resumePoolHandler(c echo.Context) error {
+	pool := c.Param("pool")
+	if err := dispatcher.Resume(pool); err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Resumed pool " + pool,
+	})
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/dispatch"
+	"github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxBatchJobs caps how many jobs one batch may submit.
+const maxBatchJobs = 10000
+
+// batchRequest submits either a list of job specs, or one job per object
+// under a storage prefix. Tenant, priority and run time apply to every job
+// that does not set its own.
+type batchRequest struct {
+	Name     string    `json:"name"`
+	Tenant   string    `json:"tenant"`
+	Priority string    `json:"priority"`
+	RunAt    string    `json:"run_at"`
+	Delay    string    `json:"delay"`
+	Jobs     []request `json:"jobs"`
+
+	SourcePrefix string             `json:"source_prefix"`
+	Destination  string             `json:"dest"`
+	Profile      string             `json:"profile"`
+	Profiles     []string           `json:"profiles"`
+	Action       string             `json:"action"`
+	Metadata     models.JobMetadata `json:"metadata"`
+	Callback     models.Callback    `json:"callback"`
+}
+
+func createBatchHandler(c echo.Context) error {
+	req := new(batchRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
+	}
+
+	batch := models.Batch{
+		GUID:   xid.New().String(),
+		Name:   req.Name,
+		Tenant: req.Tenant,
+	}
+
+	specs, err := batchSpecs(*req, batch.GUID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
+	}
+
+	// Validate every job before recording any.
+	jobs := make([]models.Job, len(specs))
+	outputs := make([][]models.JobOutput, len(specs))
+	for i, spec := range specs {
+		if jobs[i], outputs[i], err = newJob(spec); err != nil {
+			return c.JSON(http.StatusBadRequest, H{
+				"status":  http.StatusBadRequest,
+				"message": fmt.Sprintf("jobs[%d]: %s", i, err),
+			})
+		}
+	}
+
+	// The batch and its jobs are recorded together, so a failed batch can be
+	// submitted again as a whole.
+	created, submitted, duplicates, err := data.SubmitBatch(batch, jobs, outputs)
+	if err != nil {
+		log.Error(err)
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error creating batch",
+		})
+	}
+
+	if b, err := data.GetBatchByID(int(created.ID)); err == nil {
+		created = b
+	}
+	return c.JSON(http.StatusOK, H{
+		"status":     http.StatusOK,
+		"message":    "OK",
+		"batch":      created,
+		"submitted":  submitted,
+		"duplicates": duplicates,
+	})
+}
+
+// batchSpecs returns the job requests of a batch, fanning a storage prefix
+// out to one request per object.
+func batchSpecs(req batchRequest, guid string) ([]request, error) {
+	specs := req.Jobs
+	if req.SourcePrefix != "" {
+		if len(specs) > 0 {
+			return nil, fmt.Errorf("jobs and source_prefix are mutually exclusive")
+		}
+		profiles := req.Profiles
+		if req.Profile != "" {
+			profiles = append([]string{req.Profile}, profiles...)
+		}
+		planned, err := dispatch.PrefixJobs(req.SourcePrefix, req.Destination, profiles)
+		if err != nil {
+			return nil, err
+		}
+		name := req.Name
+		if name == "" {
+			name = "batch"
+		}
+		for _, pj := range planned {
+			spec := request{
+				C24JobId:       dispatch.GenerateJobID(name),
+				Source:         pj.Source,
+				Destination:    req.Destination,
+				Action:         req.Action,
+				Metadata:       req.Metadata,
+				Callback:       req.Callback,
+				IdempotencyKey: fmt.Sprintf("batch:%s:%s", guid, pj.Source),
+			}
+			for _, o := range pj.Outputs {
+				spec.Outputs = append(spec.Outputs, models.OutputSpec{Profile: o.Profile, Destination: o.URL})
+			}
+			specs = append(specs, spec)
+		}
+	}
+
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("A batch needs jobs or a source_prefix with matching objects")
+	}
+	if len(specs) > maxBatchJobs {
+		return nil, fmt.Errorf("A batch may hold at most %d jobs", maxBatchJobs)
+	}
+
+	for i := range specs {
+		if specs[i].Tenant == "" {
+			specs[i].Tenant = req.Tenant
+		}
+		if specs[i].Priority == "" {
+			specs[i].Priority = req.Priority
+		}
+		if specs[i].RunAt == "" && specs[i].Delay == "" {
+			specs[i].RunAt, specs[i].Delay = req.RunAt, req.Delay
+		}
+	}
+	return specs, nil
+}
+
+func getBatchesHandler(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	count, _ := strconv.Atoi(c.QueryParam("count"))
+	if page < 1 {
+		page = 1
+	}
+	if count < 1 || count > maxJobsCount {
+		count = defaultJobsCount
+	}
+
+	batches, err := data.GetBatches((page-1)*count, count)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error getting batches",
+		})
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status": http.StatusOK,
+		"items":  batches,
+	})
+}
+
+func getBatchByIDHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	batch, err := data.GetBatchByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Batch does not exist",
+		})
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status": http.StatusOK,
+		"batch":  batch,
+	})
+}
+
+func cancelBatchHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	batch, jobs, err := getBatchJobs(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Batch does not exist",
+		})
+	}
+
+	cancelled := 0
+	for i := range *jobs {
+		job := &(*jobs)[i]
+		if !models.CanTransition(job.Status, models.JobCancelled) {
+			continue
+		}
+		if err := cancelJob(job, "batch cancelled via API"); err != nil {
+			if err != data.ErrInvalidTransition {
+				log.Error(err)
+			}
+			continue
+		}
+		cancelled++
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status":    http.StatusOK,
+		"message":   "Batch cancelled",
+		"batch":     batch,
+		"cancelled": cancelled,
+	})
+}
+
+func retryBatchHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	req := new(retryRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
+	}
+	if req.Stage != "" && !actions.IsValidStage(req.Stage) {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": "Unknown stage: " + req.Stage,
+		})
+	}
+
+	batch, jobs, err := getBatchJobs(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Batch does not exist",
+		})
+	}
+
+	// Only failed and cancelled jobs are retried.
+	retried := 0
+	for i := range *jobs {
+		job := &(*jobs)[i]
+		if job.Status != models.JobError && job.Status != models.JobCancelled {
+			continue
+		}
+		stage := req.Stage
+		if job.Action != "transcode" {
+			stage = ""
+		}
+		if err := requeueJob(job, stage, "batch retried via API", false); err != nil {
+			if err != data.ErrInvalidTransition {
+				log.Error(err)
+			}
+			continue
+		}
+		retried++
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Batch requeued",
+		"batch":   batch,
+		"retried": retried,
+	})
+}
+
+func getBatchJobs(id int) (*models.Batch, *[]models.Job, error) {
+	batch, err := data.GetBatchByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobs, err := data.GetJobsByBatchID(batch.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return batch, jobs, nil
+}
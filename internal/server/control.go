@@ -0,0 +1,161 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/storage"
+	"github.com/harisbeha/media-transcoder/internal/webhook"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type retryRequest struct {
+	Stage string `json:"stage"`
+}
+
+func cancelJobHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	job, err := data.GetJobByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+
+	err = cancelJob(job, "cancelled via API")
+	if err == data.ErrInvalidTransition {
+		return c.JSON(http.StatusConflict, H{
+			"status":  http.StatusConflict,
+			"message": "Cannot cancel a job with status " + job.Status,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Job cancelled",
+		"job":     job,
+	})
+}
+
+func retryJobHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	req := new(retryRequest)
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
+	}
+	if req.Stage != "" && !actions.IsValidStage(req.Stage) {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": "Unknown stage: " + req.Stage,
+		})
+	}
+
+	job, err := data.GetJobByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+
+	// Download jobs only have the one stage.
+	stage := req.Stage
+	if job.Action != "transcode" {
+		stage = ""
+	}
+
+	if err := requeueJob(job, stage, "retried via API", false); err != nil {
+		return requeueErrorResponse(c, job, err)
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Job requeued",
+		"job":     job,
+	})
+}
+
+func deleteJobHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	purge := c.QueryParam("purge") == "true"
+
+	job, err := data.GetJobByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+
+	// Stop the job first if it has not finished yet.
+	if models.CanTransition(job.Status, models.JobCancelled) {
+		if err := data.UpdateJobStatusWithMessage(job.GUID, models.JobCancelled, "deleted via API"); err != nil {
+			log.Error(err)
+		}
+		stopJob(*job)
+	}
+
+	if purge {
+		for _, o := range job.Outputs {
+			if o.Status != models.OutputCompleted || o.URL == "" {
+				continue
+			}
+			if err := storage.DeleteFile(o.URL); err != nil {
+				return c.JSON(http.StatusBadGateway, H{
+					"status":  http.StatusBadGateway,
+					"message": "Error purging output: " + err.Error(),
+				})
+			}
+		}
+	}
+
+	if err := data.DeleteJob(job.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error deleting job",
+		})
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Job deleted",
+	})
+}
+
+// cancelJob cancels a job, stops its work and notifies its callback.
+func cancelJob(job *models.Job, reason string) error {
+	if err := data.UpdateJobStatusWithMessage(job.GUID, models.JobCancelled, reason); err != nil {
+		return err
+	}
+	job.Status = models.JobCancelled
+	stopJob(*job)
+
+	if err := webhook.Notify(job.GUID, models.WebhookJobCancelled, 0, nil); err != nil {
+		log.Error(err)
+	}
+	return nil
+}
+
+// stopJob takes a cancelled job off its work queue and stops any worker
+// running it. A worker already running the job also stops at its next
+// status change.
+func stopJob(job models.Job) {
+	if err := dispatcher.Stop(job); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+func getDeadLettersHandler(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	count, _ := strconv.Atoi(c.QueryParam("count"))
+	if page < 1 {
+		page = 1
+	}
+	if count < 1 || count > maxJobsCount {
+		count = defaultJobsCount
+	}
+	all := c.QueryParam("all") == "true"
+
+	dls, err := data.GetDeadLetters(all, (page-1)*count, count)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error getting dead letters",
+		})
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status": http.StatusOK,
+		"items":  dls,
+	})
+}
+
+func replayDeadLetterHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	dl, err := data.GetDeadLetterByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Dead letter does not exist",
+		})
+	}
+	if dl.ReplayedDate.Valid {
+		return c.JSON(http.StatusConflict, H{
+			"status":  http.StatusConflict,
+			"message": "Dead letter was already replayed",
+		})
+	}
+
+	job, err := data.GetJobByID(int(dl.JobID))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+
+	if err := requeueJob(job, "", "replayed from dead-letter list", false); err != nil {
+		return requeueErrorResponse(c, job, err)
+	}
+	if err := data.MarkDeadLetterReplayed(dl.ID); err != nil {
+		log.Error(err)
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Job requeued",
+		"job":     job,
+	})
+}
+
+// requeueJob moves a finished or reaped job back to its work queue. Without a stage
+// the job is queued to run its whole pipeline; with one it stays retrying
+// until a worker resumes it from that stage. Only failed and cancelled jobs
+// are requeued, unless the reaper took the job from a dead worker.
+func requeueJob(job *models.Job, stage, reason string, reaped bool) error {
+	if !reaped {
+		from := []string{models.JobError, models.JobCancelled}
+		if err := data.UpdateJobStatusFrom(job.GUID, from, models.JobRetrying, reason); err != nil {
+			return err
+		}
+		job.Status = models.JobRetrying
+	} else if job.Status != models.JobRetrying {
+		if err := data.UpdateJobStatusWithMessage(job.GUID, models.JobRetrying, reason); err != nil {
+			return err
+		}
+		job.Status = models.JobRetrying
+	}
+	if stage == "" {
+		if err := data.UpdateJobStatusWithMessage(job.GUID, models.JobQueued, reason); err != nil {
+			return err
+		}
+		job.Status = models.JobQueued
+	}
+
+	// A stale dispatch was requeued by someone else since the job was read.
+	if err := dispatcher.EnqueueFrom(*job, stage); err != nil {
+		if err != data.ErrStaleDispatch {
+			data.UpdateJobStatusWithMessage(job.GUID, models.JobError, err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+func requeueErrorResponse(c echo.Context, job *models.Job, err error) error {
+	if err == data.ErrInvalidTransition || err == data.ErrStaleDispatch {
+		return c.JSON(http.StatusConflict, H{
+			"status":  http.StatusConflict,
+			"message": "Cannot requeue a job with status " + job.Status,
+		})
+	}
+	return c.JSON(http.StatusInternalServerError, H{
+		"status":  http.StatusInternalServerError,
+		"message": err.Error(),
+	})
+}
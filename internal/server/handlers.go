@@ -2,12 +2,14 @@ package server
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	config "github.com/harisbeha/media-transcoder/internal/config"
 	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/dispatch"
+	"github.com/harisbeha/media-transcoder/internal/helpers"
 	"github.com/harisbeha/media-transcoder/internal/models"
-	"github.com/gocraft/work"
+	"github.com/harisbeha/media-transcoder/internal/webhook"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
@@ -16,7 +18,9 @@ import (
 	"k8s.io/client-go/rest"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type singleResponse struct {
@@ -34,10 +38,20 @@ type multiResponse struct {
 }
 
 type request struct {
-	Profile     string `json:"profile" binding:"required"`
-	Source      string `json:"source" binding:"required"`
-	Destination string `json:"dest" binding:"required"`
-	C24JobId    string `json:"c24_job_id" binding:"required"`
+	Profile     string              `json:"profile"`
+	Profiles    []string            `json:"profiles"`
+	Outputs     []models.OutputSpec `json:"outputs"`
+	Source      string              `json:"source" binding:"required"`
+	Destination string              `json:"dest" binding:"required"`
+	C24JobId    string              `json:"c24_job_id" binding:"required"`
+	Metadata    models.JobMetadata  `json:"metadata"`
+	Callback    models.Callback     `json:"callback"`
+	IdempotencyKey string           `json:"idempotency_key"`
+	Action      string              `json:"action"`
+	Tenant      string              `json:"tenant"`
+	Priority    string              `json:"priority"`
+	RunAt       string              `json:"run_at"`
+	Delay       string              `json:"delay"`
 }
 
 type updateRequest struct {
@@ -69,90 +83,245 @@ func CreateJob(c echo.Context) error {
 		return err
 	}
 
+	idempotencyKey := req.IdempotencyKey
+	if idempotencyKey == "" {
+		idempotencyKey = c.Request().Header.Get("Idempotency-Key")
+	}
+	req.IdempotencyKey = idempotencyKey
+
 	// Create Job and push the work to work queue.
-	job := models.Job{
-		GUID:        xid.New().String(),
-		C24JobID:    req.C24JobId,
-		Meta: 		 models.JobMetadata{},
-		Profile:     req.Profile,
-		Source:      req.Source,
-		Destination: req.Destination,
-		Status:      models.JobQueued, // Status queued.
-	}
-
-	// Send to work queue.
-	_, err := enqueuer.Enqueue(config.Get().DownloadWorkerJobName, work.Q{
-		"guid":        job.GUID,
-		"profile":     job.Profile,
-		"source":      job.Source,
-		"destination": job.Destination,
-		"c24_job_id": job.C24JobID,
-	})
+	job, outputs, err := newJob(*req)
 	if err != nil {
-		log.Fatal(err)
-	}
-	created := data.CreateJob(job)
-
-	// Create the encode relationship.
-	ed := models.EncodeData{
-		JobID: created.ID,
-		Progress: models.NullFloat64{
-			NullFloat64: sql.NullFloat64{
-				Float64: 0,
-				Valid:   true,
-			},
-		},
-		Data: models.NullString{
-			NullString: sql.NullString{
-				String: "{}",
-				Valid:  true,
-			},
-		},
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
+	}
+
+	created, isNew, err := data.SubmitJob(job, outputs)
+	if err != nil {
+		log.Error(err)
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error creating job",
+		})
+	}
+	if !isNew {
+		return c.JSON(http.StatusOK, H{
+			"status":  http.StatusOK,
+			"message": "Job already exists",
+			"job":     created,
+		})
 	}
-	edCreated := data.CreateEncodeData(ed)
-	created.EncodeDataID = edCreated.EncodeDataID
+
+	// The job is recorded pending, the scheduler sends it to its work queue.
 	log.Info(job)
 	return c.JSON(http.StatusOK, H{
 		"status": http.StatusOK,
 		"message": "OK",
+		"job":     created,
 	})
 }
 
-func getJobsHandler(c echo.Context) error {
-	page := c.QueryParam("page")
-	count := c.QueryParam("count")
-	pageParam := 0
-	countParam := 25
-	if page != "" {
-		pageParam, _ = strconv.Atoi(page)
+// newJob validates a job request and builds the job and outputs to record.
+func newJob(req request) (models.Job, []models.JobOutput, error) {
+	if req.Metadata == nil {
+		req.Metadata = models.JobMetadata{}
 	}
-	if count != "" {
-		countParam, _ = strconv.Atoi(count)
+
+	switch req.Action {
+	case "", "download", "transcode", "snippetize":
+	default:
+		return models.Job{}, nil, fmt.Errorf("Unknown action: %s", req.Action)
+	}
+
+	outputs := models.NewJobOutputs(req.Profile, req.Profiles, req.Outputs)
+	if len(outputs) == 0 {
+		return models.Job{}, nil, errors.New("At least one profile is required")
+	}
+	for _, o := range outputs {
+		if _, err := config.GetFFmpegProfile(o.Profile); err != nil {
+			return models.Job{}, nil, errors.New("Unknown profile: " + o.Profile)
+		}
+	}
+
+	if req.Priority != "" && !models.IsValidPriority(req.Priority) {
+		return models.Job{}, nil, errors.New("Unknown priority: " + req.Priority)
+	}
+
+	if err := webhook.CheckCallback(req.Callback); err != nil {
+		return models.Job{}, nil, err
+	}
+
+	runAt, err := helpers.ParseRunAt(req.RunAt, req.Delay)
+	if err != nil {
+		return models.Job{}, nil, err
+	}
+
+	idempotencyKey := req.IdempotencyKey
+	if idempotencyKey == "" {
+		idempotencyKey = models.IdempotencyKey(req.C24JobId, req.Action, outputs)
+	}
+
+	job := models.Job{
+		GUID:           xid.New().String(),
+		C24JobID:       req.C24JobId,
+		Meta:           req.Metadata,
+		Callback:       req.Callback,
+		Profile:        outputs[0].Profile,
+		Action:         req.Action,
+		Source:         req.Source,
+		Destination:    req.Destination,
+		IdempotencyKey: idempotencyKey,
+		Tenant:         req.Tenant,
+		Priority:       req.Priority,
+		RunAt:          runAt,
+		Status:         models.JobQueued, // Status queued.
+	}
+	return job, outputs, nil
+}
+
+const (
+	defaultJobsCount = 25
+	maxJobsCount     = 500
+	metaQueryPrefix  = "meta."
+)
+
+func getJobsHandler(c echo.Context) error {
+	filter, err := parseJobFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
 	}
 
 	var wg sync.WaitGroup
 	var jobs *[]models.Job
+	var next string
 	var jobsCount int
+	var jobsErr, countErr error
 
 	wg.Add(1)
 	go func() {
-		jobs = data.GetJobs((pageParam-1)*countParam, countParam)
+		jobs, next, jobsErr = data.SearchJobs(filter)
 		wg.Done()
 	}()
 
 	wg.Add(1)
 	go func() {
-		jobsCount = data.GetJobsCount()
+		jobsCount, countErr = data.CountJobs(filter)
 		wg.Done()
 	}()
 	wg.Wait()
 
+	if jobsErr == data.ErrInvalidCursor || jobsErr == data.ErrCursorMismatch || jobsErr == data.ErrInvalidSort {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": jobsErr.Error(),
+		})
+	}
+	if jobsErr != nil || countErr != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error getting jobs",
+		})
+	}
+
 	return c.JSON(http.StatusOK, H{
-		"count": jobsCount,
-		"items": jobs,
+		"count":       jobsCount,
+		"items":       jobs,
+		"next_cursor": next,
 	})
 }
 
+// parseJobFilter reads the filters, sort order and page of a jobs search
+// from the query string.
+func parseJobFilter(c echo.Context) (data.JobFilter, error) {
+	f := data.JobFilter{
+		Profile:  c.QueryParam("profile"),
+		Action:   c.QueryParam("action"),
+		C24JobID: c.QueryParam("c24_job_id"),
+		Tenant:   c.QueryParam("tenant"),
+		Sort:     c.QueryParam("sort"),
+		Desc:     true,
+		Cursor:   c.QueryParam("cursor"),
+		Limit:    defaultJobsCount,
+		Meta:     map[string]string{},
+	}
+
+	if status := c.QueryParam("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			if !models.IsValidStatus(s) {
+				return f, fmt.Errorf("unknown status: %s", s)
+			}
+			f.Statuses = append(f.Statuses, s)
+		}
+	}
+
+	if _, ok := data.JobSortFields[f.Sort]; f.Sort != "" && !ok {
+		return f, fmt.Errorf("unknown sort field: %s", f.Sort)
+	}
+	switch strings.ToLower(c.QueryParam("order")) {
+	case "", "desc":
+	case "asc":
+		f.Desc = false
+	default:
+		return f, fmt.Errorf("order must be asc or desc")
+	}
+
+	var err error
+	if f.CreatedAfter, err = parseDateParam(c.QueryParam("created_after")); err != nil {
+		return f, fmt.Errorf("invalid created_after: %s", err)
+	}
+	if f.CreatedBefore, err = parseDateParam(c.QueryParam("created_before")); err != nil {
+		return f, fmt.Errorf("invalid created_before: %s", err)
+	}
+	if batchID := c.QueryParam("batch_id"); batchID != "" {
+		if f.BatchID, err = strconv.ParseInt(batchID, 10, 64); err != nil {
+			return f, fmt.Errorf("invalid batch_id: %s", batchID)
+		}
+	}
+
+	for key, values := range c.QueryParams() {
+		if strings.HasPrefix(key, metaQueryPrefix) && len(values) > 0 {
+			f.Meta[strings.TrimPrefix(key, metaQueryPrefix)] = values[0]
+		}
+	}
+
+	if count := c.QueryParam("count"); count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("count must be a positive number")
+		}
+		if n > maxJobsCount {
+			n = maxJobsCount
+		}
+		f.Limit = n
+	}
+	if page := c.QueryParam("page"); page != "" && f.Cursor == "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("page must be a positive number")
+		}
+		f.Offset = (n - 1) * f.Limit
+	}
+	return f, nil
+}
+
+// parseDateParam parses an RFC 3339 timestamp or a plain date.
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("expected RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
 func getJobsByIDHandler(c echo.Context) error {
 	id := c.Param("id")
 	jobInt, _ := strconv.Atoi(id)
@@ -173,6 +342,79 @@ func getJobsByIDHandler(c echo.Context) error {
 	})
 }
 
+func getJobEventsHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if _, err := data.GetJobByID(id); err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+
+	events, err := data.GetJobEventsByJobID(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error getting job events",
+		})
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status": http.StatusOK,
+		"events": events,
+	})
+}
+
+func getJobWebhooksHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if _, err := data.GetJobByID(id); err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+
+	deliveries, err := data.GetWebhookDeliveriesByJobID(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": "Error getting webhook deliveries",
+		})
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status":     http.StatusOK,
+		"deliveries": deliveries,
+	})
+}
+
+func redeliverWebhookHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	if _, err := data.GetWebhookDeliveryByID(id); err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Delivery does not exist",
+		})
+	}
+
+	delivery, err := webhook.Redeliver(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, H{
+			"status":  http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, H{
+		"status":   http.StatusAccepted,
+		"message":  "Delivery queued",
+		"delivery": delivery,
+	})
+}
+
 func updateJobByIDHandler(c echo.Context) error {
 	id, _ := strconv.Atoi(c.Param("id"))
 
@@ -199,11 +441,35 @@ func updateJobByIDHandler(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, resp)
 	}
 
-	if jsonData.Status != "" {
-		job.Status = jsonData.Status
+	if jsonData.Status == "" {
+		return c.JSON(http.StatusOK, job)
+	}
+
+	if !models.IsValidStatus(jsonData.Status) {
+		return c.JSON(http.StatusBadRequest, singleResponse{
+			Message: "Unknown status: " + jsonData.Status,
+			Status:  http.StatusBadRequest,
+			Job:     job,
+		})
 	}
 
-	updatedJob := data.UpdateJobByID(id, *job)
+	from := job.Status
+	job.Status = jsonData.Status
+	updatedJob, err := data.UpdateJobByID(id, from, *job)
+	if err == data.ErrInvalidTransition {
+		return c.JSON(http.StatusConflict, singleResponse{
+			Message: fmt.Sprintf("Cannot move job from %s to %s", from, jsonData.Status),
+			Status:  http.StatusConflict,
+			Job:     nil,
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, singleResponse{
+			Message: err.Error(),
+			Status:  http.StatusInternalServerError,
+			Job:     nil,
+		})
+	}
 	return c.JSON(http.StatusOK, updatedJob)
 }
 
@@ -225,49 +491,6 @@ func getStatsHandler(c echo.Context) error {
 	})
 }
 
-func workerQueueHandler(c echo.Context) error {
-	transcodeClient := work.NewClient(config.Get().TranscodeWorkerNamespace, redisPool)
-	downloadClient := work.NewClient(config.Get().DownloadWorkerNamespace, redisPool)
-
-	transcodeQueues, err := transcodeClient.Queues()
-	downloadQueues, err := downloadClient.Queues()
-	respSize := len(transcodeQueues) + len(downloadQueues)
-	queues := make([]*work.Queue, 0, respSize)
-	log.Info(queues)
-
-	if err != nil {
-		fmt.Println(err)
-	}
-	return c.JSON(200, transcodeQueues)
-}
-
-func workerPoolsHandler(c echo.Context) error {
-	client := work.NewClient(config.Get().TranscodeWorkerNamespace, redisPool)
-
-	resp, err := client.WorkerPoolHeartbeats()
-	if err != nil {
-		fmt.Println(err)
-	}
-	return c.JSON(200, resp)
-}
-
-func workerBusyHandler(c echo.Context) error {
-	client := work.NewClient(config.Get().TranscodeWorkerNamespace, redisPool)
-
-	observations, err := client.WorkerObservations()
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	var busyObservations []*work.WorkerObservation
-	for _, ob := range observations {
-		if ob.IsBusy {
-			busyObservations = append(busyObservations, ob)
-		}
-	}
-	return c.JSON(200, busyObservations)
-}
-
 type s3ListResponse struct {
 	Folders []string `json:"folders"`
 	Files   []file   `json:"files"`
@@ -313,6 +536,12 @@ func profilesHandler(c echo.Context) error {
 	})
 }
 
+func schedulesHandler(c echo.Context) error {
+	return c.JSON(200, H{
+		"schedules": dispatch.Schedules(),
+	})
+}
+
 func machinesHandler(c echo.Context) error {
 	ctx := context.TODO()
 
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	"github.com/harisbeha/media-transcoder/internal/storage"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// getJobLogsHandler serves the log of a job's worker: streamed from its pod
+// while it runs, with ?follow=true until it exits, and from the log archive
+// once the pod is gone. ?pod= picks a pod of an earlier run; archived logs
+// of every run are served when none is given and no pod is left.
+func getJobLogsHandler(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	follow := c.QueryParam("follow") == "true"
+	pod := c.QueryParam("pod")
+
+	job, err := data.GetJobByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+
+	stream, err := dispatcher.Logs(*job, pod, follow)
+	if err == nil {
+		defer stream.Close()
+		return streamLog(c, stream)
+	}
+	if err != executor.ErrNoWorker {
+		log.Error(err)
+	}
+
+	logs, err := storage.ListLogs(job.GUID)
+	if err != nil || len(logs) == 0 {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "No logs for job",
+		})
+	}
+
+	pods := []string{pod}
+	if _, ok := logs[pod]; pod != "" && !ok {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "No logs for pod " + pod,
+		})
+	}
+	if pod == "" {
+		pods = make([]string, 0, len(logs))
+		for p := range logs {
+			pods = append(pods, p)
+		}
+		sort.Strings(pods)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+	for _, p := range pods {
+		out, err := storage.ReadFile(logs[p])
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if len(pods) > 1 {
+			fmt.Fprintf(c.Response(), "==> %s <==\n", p)
+		}
+		io.WriteString(c.Response(), out)
+	}
+	return nil
+}
+
+// streamLog copies a log stream to the response as it arrives, until the
+// stream ends or the client goes away.
+func streamLog(c echo.Context, stream io.ReadCloser) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.Request().Context().Done():
+			stream.Close()
+		case <-done:
+		}
+	}()
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, werr := c.Response().Write(buf[:n]); werr != nil {
+				return nil
+			}
+			c.Response().Flush()
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
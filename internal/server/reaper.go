@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// runReaper reaps jobs whose worker stopped renewing its lease, until ctx is
+// done.
+func runReaper(ctx context.Context) {
+	interval := config.Get().ReaperInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reapExpiredLeases()
+		}
+	}
+}
+
+// reapExpiredLeases requeues the jobs whose lease expired from the stage
+// their worker was in, or fails them once they were reaped as many times
+// as their profile attempts a stage.
+func reapExpiredLeases() {
+	jobs, err := data.GetExpiredLeases()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, job := range *jobs {
+		reaped, err := data.ReapLease(job.ID, job.LeaseID.String)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if !reaped {
+			continue
+		}
+		job.ReapedCount++
+
+		// Make sure a hung worker doesn't carry on next to the new one.
+		stopJob(job)
+
+		reason := fmt.Sprintf("lease of worker %s expired during %s", job.LeaseOwner, job.LeaseStage)
+		log.Warnf("job %s: %s", job.GUID, reason)
+
+		if job.ReapedCount >= config.MaxAttempts(job.Profile) {
+			actions.FailJob(job, &actions.ExhaustedError{
+				Stage:    job.LeaseStage,
+				Attempts: job.ReapedCount,
+				Err:      errors.New(reason),
+			})
+			continue
+		}
+
+		if err := requeueJob(&job, reapStage(job), reason, true); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// reapStage returns the stage a reaped job resumes from: the one its worker
+// was in, except that uploads encode again, as the outputs may have gone
+// with the worker. Download jobs only have the one stage.
+func reapStage(job models.Job) string {
+	if job.Action != "transcode" {
+		return ""
+	}
+	switch job.LeaseStage {
+	case actions.StageUpload:
+		return actions.StageEncode
+	case "":
+		return actions.StageProbe
+	}
+	return job.LeaseStage
+}
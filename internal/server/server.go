@@ -1,16 +1,19 @@
 package server
 
 import (
+	"context"
 	"fmt"
-	"github.com/gocraft/work"
+	"github.com/harisbeha/media-transcoder/internal/dispatch"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	"github.com/harisbeha/media-transcoder/internal/webhook"
 	"github.com/gomodule/redigo/redis"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
 
 var (
-	redisPool *redis.Pool
-	enqueuer  *work.Enqueuer
+	redisPool  *redis.Pool
+	dispatcher *dispatch.Dispatcher
 )
 
 // Config defines configuration for creating a NewServer.
@@ -34,7 +37,12 @@ func NewServer(serverCfg Config) {
 			return redis.DialURL(fmt.Sprintf("%s:%d", serverCfg.RedisHost, serverCfg.RedisPort))
 		},
 	}
-	enqueuer = work.NewEnqueuer(serverCfg.Namespace, redisPool)
+	// The server only cancels jobs and streams their logs, so it starts
+	// even where the executor can't be created yet, e.g. outside the
+	// cluster.
+	dispatcher = dispatch.New(redisPool, executor.NewLazy(redisPool))
+	go runReaper(context.Background())
+	go webhook.Run(context.Background())
 
 	e := echo.New()
 	e.GET("/", func(c echo.Context) error {
@@ -65,11 +73,34 @@ func NewServer(serverCfg Config) {
 		// Profiles.
 		api.GET("/profiles", profilesHandler)
 
+		// Schedules.
+		api.GET("/schedules", schedulesHandler)
+
 		// Jobs.
 		api.POST("/jobs", CreateJob)
 		api.GET("/jobs", getJobsHandler)
 		api.GET("/jobs/:id", getJobsByIDHandler)
 		api.PUT("/jobs/:id", updateJobByIDHandler)
+		api.DELETE("/jobs/:id", deleteJobHandler)
+		api.POST("/jobs/:id/cancel", cancelJobHandler)
+		api.POST("/jobs/:id/retry", retryJobHandler)
+		api.GET("/jobs/:id/events", getJobEventsHandler)
+		api.GET("/jobs/:id/webhooks", getJobWebhooksHandler)
+		api.GET("/jobs/:id/logs", getJobLogsHandler)
+
+		// Batches.
+		api.GET("/batches", getBatchesHandler)
+		api.POST("/batches", createBatchHandler)
+		api.GET("/batches/:id", getBatchByIDHandler)
+		api.POST("/batches/:id/cancel", cancelBatchHandler)
+		api.POST("/batches/:id/retry", retryBatchHandler)
+
+		// Dead letters.
+		api.GET("/dead-letters", getDeadLettersHandler)
+		api.POST("/dead-letters/:id/replay", replayDeadLetterHandler)
+
+		// Webhooks.
+		api.POST("/webhooks/:id/redeliver", redeliverWebhookHandler)
 
 		// Stats.
 		api.GET("/stats", getStatsHandler)
@@ -78,6 +109,15 @@ func NewServer(serverCfg Config) {
 		api.GET("/worker/queue", workerQueueHandler)
 		api.GET("/worker/pools", workerPoolsHandler)
 		api.GET("/worker/busy", workerBusyHandler)
+		api.GET("/worker/capabilities", workerCapabilitiesHandler)
+		api.GET("/worker/dead", getDeadJobsHandler)
+		api.POST("/worker/dead/:pool/retry", retryDeadJobsHandler)
+		api.POST("/worker/dead/:pool/:died_at/:id/retry", retryDeadJobHandler)
+
+		// Admin.
+		api.GET("/admin/drain", getDrainHandler)
+		api.POST("/admin/drain/:pool", drainPoolHandler)
+		api.DELETE("/admin/drain/:pool", resumePoolHandler)
 
 		// Machines.
 		api.GET("/machines", machinesHandler)
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gocraft/work"
+	"github.com/harisbeha/media-transcoder/internal/capability"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/queue"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// workNamespace is the gocraft/work namespace a worker pool runs jobs of.
+type workNamespace struct {
+	pool      string
+	namespace string
+}
+
+// workNamespaces returns the namespaces of the transcode and download
+// worker pools, once each when they share one.
+func workNamespaces() []workNamespace {
+	namespaces := []workNamespace{
+		{queue.PoolTranscode, config.Get().TranscodeWorkerNamespace},
+	}
+	if ns := config.Get().DownloadWorkerNamespace; ns != namespaces[0].namespace {
+		namespaces = append(namespaces, workNamespace{queue.PoolDownload, ns})
+	}
+	return namespaces
+}
+
+// poolNamespaces returns the namespaces of the named worker pool, or of
+// all pools when name is empty. It reports false for an unknown pool.
+func poolNamespaces(name string) ([]workNamespace, bool) {
+	if name == "" {
+		return workNamespaces(), true
+	}
+	for _, ns := range workNamespaces() {
+		if ns.pool == name {
+			return []workNamespace{ns}, true
+		}
+	}
+	return nil, false
+}
+
+// workerPool is a worker pool's heartbeat with the capabilities its
+// process advertises.
+type workerPool struct {
+	Pool      string `json:"pool"`
+	Namespace string `json:"namespace"`
+	*work.WorkerPoolHeartbeat
+	Capabilities *capability.Capabilities `json:"capabilities"`
+}
+
+// workerObservation is what a busy worker of a pool is doing.
+type workerObservation struct {
+	Pool      string `json:"pool"`
+	Namespace string `json:"namespace"`
+	*work.WorkerObservation
+}
+
+// deadJob is a job of a pool that ran out of work queue retries.
+type deadJob struct {
+	Pool string `json:"pool"`
+	*work.DeadJob
+}
+
+// workerQueueHandler lists the work queues of all worker pools with their
+// size, latency, and scheduled, retry and dead counts.
+func workerQueueHandler(c echo.Context) error {
+	stats := []queue.Stats{}
+	for _, ns := range workNamespaces() {
+		s, err := queue.QueueStats(redisPool, ns.pool, ns.namespace)
+		if err != nil {
+			return workerError(c, err)
+		}
+		stats = append(stats, s...)
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+func workerPoolsHandler(c echo.Context) error {
+	workers, err := capability.List(redisPool)
+	if err != nil {
+		return workerError(c, err)
+	}
+
+	pools := []workerPool{}
+	for _, ns := range workNamespaces() {
+		heartbeats, err := work.NewClient(ns.namespace, redisPool).WorkerPoolHeartbeats()
+		if err != nil {
+			return workerError(c, err)
+		}
+		for _, hb := range heartbeats {
+			p := workerPool{Pool: ns.pool, Namespace: ns.namespace, WorkerPoolHeartbeat: hb}
+			for i, w := range workers {
+				if w.Pool == ns.pool && w.Host == hb.Host && w.Pid == hb.Pid {
+					p.Capabilities = &workers[i]
+				}
+			}
+			pools = append(pools, p)
+		}
+	}
+	return c.JSON(http.StatusOK, pools)
+}
+
+func workerBusyHandler(c echo.Context) error {
+	busy := []workerObservation{}
+	for _, ns := range workNamespaces() {
+		observations, err := work.NewClient(ns.namespace, redisPool).WorkerObservations()
+		if err != nil {
+			return workerError(c, err)
+		}
+		for _, ob := range observations {
+			if ob.IsBusy {
+				busy = append(busy, workerObservation{Pool: ns.pool, Namespace: ns.namespace, WorkerObservation: ob})
+			}
+		}
+	}
+	return c.JSON(http.StatusOK, busy)
+}
+
+// workerCapabilitiesHandler lists the capabilities live workers advertise.
+func workerCapabilitiesHandler(c echo.Context) error {
+	workers, err := capability.List(redisPool)
+	if err != nil {
+		return workerError(c, err)
+	}
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"count":   len(workers),
+		"workers": workers,
+	})
+}
+
+// getDeadJobsHandler lists the dead jobs of a worker pool, or of all pools,
+// newest first, a page of up to 20 per pool at a time.
+func getDeadJobsHandler(c echo.Context) error {
+	namespaces, ok := poolNamespaces(c.QueryParam("pool"))
+	if !ok {
+		return unknownPool(c, c.QueryParam("pool"))
+	}
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	jobs := []deadJob{}
+	var total int64
+	for _, ns := range namespaces {
+		dead, count, err := work.NewClient(ns.namespace, redisPool).DeadJobs(uint(page))
+		if err != nil {
+			return workerError(c, err)
+		}
+		for _, j := range dead {
+			jobs = append(jobs, deadJob{Pool: ns.pool, DeadJob: j})
+		}
+		total += count
+	}
+
+	return c.JSON(http.StatusOK, H{
+		"status": http.StatusOK,
+		"count":  total,
+		"jobs":   jobs,
+	})
+}
+
+// retryDeadJobHandler requeues the job of a dead work queue job through the
+// dispatcher, from the stage it died in, and drops the dead job.
+func retryDeadJobHandler(c echo.Context) error {
+	namespaces, ok := poolNamespaces(c.Param("pool"))
+	if !ok || c.Param("pool") == "" {
+		return unknownPool(c, c.Param("pool"))
+	}
+	diedAt, err := strconv.ParseInt(c.Param("died_at"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, H{
+			"status":  http.StatusBadRequest,
+			"message": "Invalid died_at: " + c.Param("died_at"),
+		})
+	}
+
+	ns := namespaces[0].namespace
+	dead, err := queue.DeadJob(redisPool, ns, diedAt, c.Param("id"))
+	if err != nil {
+		return workerError(c, err)
+	}
+	if dead == nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Dead job does not exist",
+		})
+	}
+
+	job, err := retryDeadJob(ns, diedAt, dead)
+	if job == nil {
+		return c.JSON(http.StatusNotFound, H{
+			"status":  http.StatusNotFound,
+			"message": "Job does not exist",
+		})
+	}
+	if err != nil {
+		return requeueErrorResponse(c, job, err)
+	}
+	return c.JSON(http.StatusOK, H{
+		"status":  http.StatusOK,
+		"message": "Job requeued",
+		"job":     job,
+	})
+}
+
+// retryDeadJobsHandler requeues the jobs of all dead work queue jobs of a
+// worker pool. Dead jobs whose job can't be requeued are kept.
+func retryDeadJobsHandler(c echo.Context) error {
+	namespaces, ok := poolNamespaces(c.Param("pool"))
+	if !ok || c.Param("pool") == "" {
+		return unknownPool(c, c.Param("pool"))
+	}
+
+	ns := namespaces[0].namespace
+	client := work.NewClient(ns, redisPool)
+	dead := []*work.DeadJob{}
+	for page := uint(1); ; page++ {
+		jobs, count, err := client.DeadJobs(page)
+		if err != nil {
+			return workerError(c, err)
+		}
+		dead = append(dead, jobs...)
+		if len(jobs) == 0 || int64(len(dead)) >= count {
+			break
+		}
+	}
+
+	requeued, skipped := 0, 0
+	for _, d := range dead {
+		if _, err := retryDeadJob(ns, d.DiedAt, d.Job); err != nil {
+			if err != data.ErrInvalidTransition {
+				log.Errorf("retrying dead job %s: %v", d.ID, err)
+			}
+			skipped++
+			continue
+		}
+		requeued++
+	}
+	return c.JSON(http.StatusOK, H{
+		"status":   http.StatusOK,
+		"message":  "Dead jobs requeued",
+		"requeued": requeued,
+		"skipped":  skipped,
+	})
+}
+
+// retryDeadJob requeues the job a dead work queue job carries, from the
+// stage it was enqueued with, and drops the dead job once it is. Jobs that
+// have not failed or been cancelled since, e.g. because they were re-run,
+// are not requeued and keep their dead job. It returns a nil job when the
+// job does not exist.
+func retryDeadJob(namespace string, diedAt int64, dead *work.Job) (*models.Job, error) {
+	job, err := data.GetJobByGUID(dead.ArgString("guid"))
+	if err != nil {
+		return nil, err
+	}
+	_, stage := queue.JobFromArgs(dead)
+	if err := requeueJob(job, stage, "retried from dead work queue jobs", false); err != nil {
+		return job, err
+	}
+	err = work.NewClient(namespace, redisPool).DeleteDeadJob(diedAt, dead.ID)
+	if err != nil && err != work.ErrNotDeleted {
+		log.Error(err)
+	}
+	return job, nil
+}
+
+func unknownPool(c echo.Context, pool string) error {
+	return c.JSON(http.StatusBadRequest, H{
+		"status":  http.StatusBadRequest,
+		"message": "Unknown pool: " + pool,
+	})
+}
+
+func workerError(c echo.Context, err error) error {
+	return c.JSON(http.StatusInternalServerError, H{
+		"status":  http.StatusInternalServerError,
+		"message": err.Error(),
+	})
+}
@@ -5,13 +5,12 @@ import (
 	"github.com/harisbeha/media-transcoder/internal/actions"
 	_ "github.com/harisbeha/media-transcoder/internal/actions"
 	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/queue"
 	"github.com/harisbeha/media-transcoder/internal/models"
 	_ "github.com/harisbeha/media-transcoder/internal/models"
 	"github.com/gocraft/work"
 	"github.com/gomodule/redigo/redis"
 	log "github.com/sirupsen/logrus"
-	"os"
-	"os/signal"
 )
 
 // NewWorker creates a new worker instance to listen and process jobs in the queue.
@@ -28,15 +27,7 @@ func NewDownloadWorker(workerCfg WorkerConfig) {
 	}
 
 	// Make a new pool.
-	pool := work.NewWorkerPool(Context{},
-		workerCfg.Concurrency, workerCfg.Namespace, redisPool)
-
-	// Add middleware that will be executed for each job
-	pool.Middleware((*Context).Log)
-	pool.Middleware((*Context).FindJob)
-
-	// Map the name of jobs to handler functions
-	pool.Job(config.Get().DownloadWorkerJobName, (*Context).SendDownloadJob)
+	pool := newDownloadPool(redisPool, workerCfg.Namespace, workerCfg.Concurrency)
 
 	// Customize options:
 	// pool.JobWithOptions("export", work.JobOptions{Priority: 10, MaxFails: 1}, (*Context).Export)
@@ -44,13 +35,27 @@ func NewDownloadWorker(workerCfg WorkerConfig) {
 	// Start processing jobs
 	pool.Start()
 
-	// Wait for a signal to quit:
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, os.Kill)
-	<-signalChan
+	// Wait for a signal to quit.
+	waitForShutdown(nil)
 
 	// Stop the pool
-	pool.Stop()
+	actions.StopPool(pool)
+}
+
+// newDownloadPool creates a worker pool running download jobs.
+func newDownloadPool(redisPool *redis.Pool, namespace string, concurrency uint) *work.WorkerPool {
+	pool := work.NewWorkerPool(Context{}, concurrency, namespace, redisPool)
+
+	// Add middleware that will be executed for each job
+	pool.Middleware((*Context).Log)
+	pool.Middleware((*Context).FindJob)
+	pool.Middleware(actions.Checkin)
+
+	// Map the name of jobs to handler functions
+	for name, opts := range queue.PriorityJobs(config.Get().DownloadWorkerJobName) {
+		pool.JobWithOptions(name, opts, (*Context).SendDownloadJob)
+	}
+	return pool
 }
 
 // SendJob worker handler for running job.
@@ -69,8 +74,11 @@ func (c *Context) SendDownloadJob(job *work.Job) error {
 		Destination: destination,
 	}
 
-	// Start job.
-	actions.RunDownloadJob(j)
+	// Start job. Stages retry transient failures themselves and exhausted
+	// jobs are dead-lettered, so the queue must not retry the job again.
+	if err := actions.RunDownloadJob(j); err != nil {
+		log.Errorf("worker: job %s failed: %v", j.GUID, err)
+	}
 	log.Infof("worker: completed %s!\n", j.Profile)
 	//defer os.Exit(0)
 	return nil
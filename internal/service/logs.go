@@ -0,0 +1,103 @@
+package service
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/harisbeha/media-transcoder/internal/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// workerLog tees the worker's stdout and stderr to a file, which is archived
+// as the log of the job it ran once the worker exits, so the log outlives
+// the worker's pod.
+type workerLog struct {
+	file    *os.File
+	stdout  *os.File
+	stderr  *os.File
+	pipes   []*os.File
+	wg      sync.WaitGroup
+	once    sync.Once
+	mu      sync.Mutex
+	current string
+}
+
+// startWorkerLog starts teeing the worker's output to a temporary file.
+func startWorkerLog() (*workerLog, error) {
+	file, err := ioutil.TempFile("", "worker-*.log")
+	if err != nil {
+		return nil, err
+	}
+	l := &workerLog{file: file, stdout: os.Stdout, stderr: os.Stderr}
+	if os.Stdout, err = l.tee(os.Stdout); err != nil {
+		return nil, err
+	}
+	if os.Stderr, err = l.tee(os.Stderr); err != nil {
+		os.Stdout = l.stdout
+		return nil, err
+	}
+	// The logger holds on to the stderr it was created with.
+	log.SetOutput(os.Stderr)
+	return l, nil
+}
+
+func (l *workerLog) tee(out *os.File) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	l.pipes = append(l.pipes, w)
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		io.Copy(io.MultiWriter(out, l.file), r)
+		r.Close()
+	}()
+	return w, nil
+}
+
+// Running records the job the worker is running.
+func (l *workerLog) Running(guid string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = guid
+}
+
+// Archive stops teeing the worker's output and uploads the log as that of
+// the job it was running, if any. Output after Archive is not archived.
+func (l *workerLog) Archive() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		os.Stdout, os.Stderr = l.stdout, l.stderr
+		log.SetOutput(os.Stderr)
+		for _, w := range l.pipes {
+			w.Close()
+		}
+		l.wg.Wait()
+		l.file.Close()
+		defer os.Remove(l.file.Name())
+
+		l.mu.Lock()
+		guid := l.current
+		l.mu.Unlock()
+		if guid == "" {
+			return
+		}
+
+		pod, err := os.Hostname()
+		if err != nil {
+			log.Error(err)
+			return
+		}
+		if err := storage.UploadFile(l.file.Name(), storage.LogURL(guid, pod)); err != nil {
+			log.Errorf("worker: archiving log of job %s: %v", guid, err)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/harisbeha/media-transcoder/internal/actions"
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/dispatch"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewPipelineWorker runs the whole pipeline in one process: it releases
+// pending jobs and recurring schedules like the dispatcher, and runs the
+// download, probe, encode and upload stages of the jobs itself, each up to
+// its stage concurrency. Together with the server it is all a small install
+// needs.
+func NewPipelineWorker(workerCfg WorkerConfig) {
+	concurrency := pipelineConcurrency(workerCfg.Concurrency)
+
+	// Make a redis pool
+	redisPool := &redis.Pool{
+		MaxActive: 5 + 2*int(concurrency),
+		MaxIdle:   5,
+		Wait:      true,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(fmt.Sprintf("%s:%d", workerCfg.Host, workerCfg.Port))
+		},
+	}
+
+	// Transcodes run in a local pool whatever the configured executor, so
+	// the server should use the local executor too to cancel them.
+	if e := config.Get().Executor; e != executor.TypeLocal {
+		log.Warnf("worker: running transcodes locally, but the executor is %q", e)
+	}
+	dispatcher := dispatch.New(redisPool, executor.NewLocal(redisPool, concurrency))
+	downloads := newDownloadPool(redisPool, config.Get().DownloadWorkerNamespace, concurrency)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	running := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(running)
+	}()
+	go dispatcher.RunSchedules(ctx)
+	downloads.Start()
+
+	// Wait for a signal to quit.
+	waitForShutdown(nil)
+
+	// Stop releasing jobs and let both pools drain.
+	cancel()
+	actions.StopPool(downloads)
+	<-running
+}
+
+// pipelineConcurrency returns how many jobs the pipeline worker runs at
+// once: as many as all stages together allow, or the worker concurrency
+// when no stage is limited.
+func pipelineConcurrency(fallback uint) uint {
+	total := 0
+	for _, stage := range actions.Stages {
+		total += config.GetStageConcurrency(stage)
+	}
+	if total > 0 {
+		return uint(total)
+	}
+	if fallback > 0 {
+		return fallback
+	}
+	return 1
+}
@@ -5,17 +5,29 @@ import (
 	"github.com/harisbeha/media-transcoder/internal/actions"
 	_ "github.com/harisbeha/media-transcoder/internal/actions"
 	_ "github.com/harisbeha/media-transcoder/internal/config"
-	"github.com/harisbeha/media-transcoder/internal/models"
+	"github.com/harisbeha/media-transcoder/internal/queue"
 	_ "github.com/harisbeha/media-transcoder/internal/models"
 	"github.com/gocraft/work"
 	"github.com/gomodule/redigo/redis"
 	log "github.com/sirupsen/logrus"
 	"os"
-	"os/signal"
+)
+
+var (
+	// transcodeLog is the log of the transcode worker, archived when it exits.
+	transcodeLog *workerLog
+
+	// transcodeDone receives once the worker ran its job. Each Kubernetes
+	// Job runs one transcode job, so the worker then stops.
+	transcodeDone = make(chan struct{}, 1)
 )
 
 // NewWorker creates a new worker instance to listen and process jobs in the queue.
 func NewTranscodeWorker(workerCfg WorkerConfig) {
+	var err error
+	if transcodeLog, err = startWorkerLog(); err != nil {
+		log.Errorf("worker: not archiving log: %v", err)
+	}
 
 	// Make a redis pool
 	redisPool := &redis.Pool{
@@ -36,9 +48,12 @@ func NewTranscodeWorker(workerCfg WorkerConfig) {
 	// Add middleware that will be executed for each job
 	pool.Middleware((*Context).Log)
 	pool.Middleware((*Context).FindJob)
+	pool.Middleware(actions.Checkin)
 
 	// Map the name of jobs to handler functions
-	pool.Job(jobName, (*Context).SendTranscodeJob)
+	for name, opts := range queue.PriorityJobs(jobName) {
+		pool.JobWithOptions(name, opts, (*Context).SendTranscodeJob)
+	}
 
 	// Customize options:
 	//pool.JobWithOptions("export", work.JobOptions{Priority: 10, MaxFails: 1}, (*Context).Export)
@@ -46,32 +61,28 @@ func NewTranscodeWorker(workerCfg WorkerConfig) {
 	// Start processing jobs
 	pool.Start()
 
-	// Wait for a signal to quit:
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, os.Kill)
-	<-signalChan
+	// Wait for the job to finish or a signal to quit.
+	waitForShutdown(transcodeDone)
 
 	// Stop the pool
-	pool.Stop()
+	actions.StopPool(pool)
+	transcodeLog.Archive()
 }
 
 // SendJob worker handler for running job.
 func (c *Context) SendTranscodeJob(job *work.Job) error {
-	guid := job.ArgString("guid")
-	profile := job.ArgString("profile")
-	source := job.ArgString("source")
-	destination := job.ArgString("destination")
+	j, stage := queue.JobFromArgs(job)
+	transcodeLog.Running(j.GUID)
 
-	j := models.Job{
-		GUID:        guid,
-		Profile:     profile,
-		Source:      source,
-		Destination: destination,
+	// Start job. Stages retry transient failures themselves and exhausted
+	// jobs are dead-lettered, so the queue must not retry the job again.
+	if err := actions.RunEncodeJobFrom(j, stage); err != nil {
+		log.Errorf("worker: job %s failed: %v", j.GUID, err)
 	}
-
-	// Start job.
-	actions.RunEncodeJob(j)
 	log.Infof("worker: completed %s!\n", j.Profile)
-	defer os.Exit(0)
+	select {
+	case transcodeDone <- struct{}{}:
+	default:
+	}
 	return nil
 }
\ No newline at end of file
@@ -5,6 +5,9 @@ import (
 	"github.com/harisbeha/media-transcoder/internal/models"
 	"github.com/gocraft/work"
 	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -25,6 +28,20 @@ type Context struct {
 	Destination string
 }
 
+// waitForShutdown blocks until the worker is asked to stop with SIGINT or
+// SIGTERM, or until done receives.
+func waitForShutdown(done <-chan struct{}) {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
+
+	select {
+	case sig := <-signalChan:
+		log.Infof("worker: received %s, draining", sig)
+	case <-done:
+	}
+}
+
 // Log worker middleware for logging job.
 func (c *Context) Log(job *work.Job, next work.NextMiddlewareFunc) error {
 	log.Infof("worker: starting job %s\n", job.Name)
@@ -2,20 +2,29 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"os/exec"
+	"strings"
 	log "github.com/sirupsen/logrus"
 )
 
 func gsUtil(args ...string) error {
+	_, err := gsUtilOutput(args...)
+	return err
+}
+
+func gsUtilOutput(args ...string) (string, error) {
 	cmd := exec.Command("gsutil", args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err := cmd.Run()
 	if err != nil {
-		return err
+		// Keep gsutil's own message; it tells transient failures apart.
+		return "", fmt.Errorf("gsutil %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
 	}
-	return nil
+	return stdout.String(), nil
 }
 
 func UploadFile(path string, gsURL string) error {
@@ -38,4 +47,45 @@ func DownloadFile(srcUrl string, path string) error {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+// DeleteFile removes an object from storage.
+func DeleteFile(gsURL string) error {
+	if gsURL != "" {
+		log.Print(gsURL)
+		err := gsUtil("rm", gsURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListFiles lists the objects under a storage prefix.
+func ListFiles(prefix string) ([]string, error) {
+	out, err := gsUtilOutput("ls", "-r", prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		// Skip blank lines and the "dir:" headers of a recursive listing.
+		if line == "" || strings.HasSuffix(line, "/") || strings.HasSuffix(line, ":") {
+			continue
+		}
+		files = append(files, line)
+	}
+	return files, nil
+}
+
+// ReadHead reads the first n bytes of an object from storage.
+func ReadHead(ctx context.Context, gsURL string, n int64) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "gsutil", "cat", "-r", fmt.Sprintf("0-%d", n-1), gsURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gsutil cat: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
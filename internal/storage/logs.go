@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+)
+
+// logArchive returns the storage prefix worker logs are archived under.
+func logArchive() string {
+	if prefix := config.Get().LogArchive; prefix != "" {
+		return strings.TrimSuffix(prefix, "/")
+	}
+	return fmt.Sprintf("gs://%s/logs", config.Get().GCSBucket)
+}
+
+// LogURL returns where the log of a job's worker pod is archived.
+func LogURL(guid, pod string) string {
+	return fmt.Sprintf("%s/%s/%s.log", logArchive(), guid, pod)
+}
+
+// ListLogs lists the archived logs of a job's worker pods, by pod name.
+func ListLogs(guid string) (map[string]string, error) {
+	files, err := ListFiles(fmt.Sprintf("%s/%s/", logArchive(), guid))
+	if err != nil {
+		return nil, err
+	}
+	logs := map[string]string{}
+	for _, f := range files {
+		logs[strings.TrimSuffix(path.Base(f), ".log")] = f
+	}
+	return logs, nil
+}
+
+// ReadFile reads an object from storage.
+func ReadFile(gsURL string) (string, error) {
+	return gsUtilOutput("cat", gsURL)
+}
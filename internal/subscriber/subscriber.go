@@ -1,30 +1,30 @@
 package subscriber
 
 import (
-	"cloud.google.com/go/pubsub"
-	pubsubClient "cloud.google.com/go/pubsub"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
-	"github.com/harisbeha/media-transcoder/internal/actions"
 	config "github.com/harisbeha/media-transcoder/internal/config"
 	"github.com/harisbeha/media-transcoder/internal/data"
+	"github.com/harisbeha/media-transcoder/internal/helpers"
+	"github.com/harisbeha/media-transcoder/internal/dispatch"
+	"github.com/harisbeha/media-transcoder/internal/executor"
+	"github.com/harisbeha/media-transcoder/internal/intake"
 	models "github.com/harisbeha/media-transcoder/internal/models"
-	"github.com/gocraft/work"
+	"github.com/harisbeha/media-transcoder/internal/webhook"
 	"github.com/gomodule/redigo/redis"
 	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
-	"google.golang.org/api/iterator"
 	"math/rand"
-	"sync"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 var (
-	redisPool *redis.Pool
-	downloadEnqueuer  *work.Enqueuer
-	transcodeEnqueuer *work.Enqueuer
+	redisPool  *redis.Pool
+	dispatcher *dispatch.Dispatcher
 )
 
 // Config defines configuration for creating a NewServer.
@@ -35,14 +35,24 @@ type Config struct {
 	Namespace   string
 	JobName     string
 	Concurrency uint
+	Intake      intake.Config
 }
 
 type request struct {
-	C24JobId    string `json:"c24_job_id" binding:"required"`
-	Profile     string `json:"profile" binding:"required"`
-	Source      string `json:"source" binding:"required"`
-	Destination string `json:"dest" binding:"required"`
-	Action      string `json:"action" binding:"action"`
+	C24JobId    string              `json:"c24_job_id" binding:"required"`
+	Profile     string              `json:"profile"`
+	Profiles    []string            `json:"profiles"`
+	Outputs     []models.OutputSpec `json:"outputs"`
+	Source      string              `json:"source" binding:"required"`
+	Destination string              `json:"dest" binding:"required"`
+	Action      string              `json:"action" binding:"action"`
+	Metadata    models.JobMetadata  `json:"metadata"`
+	Callback    models.Callback     `json:"callback"`
+	IdempotencyKey string           `json:"idempotency_key"`
+	Tenant      string              `json:"tenant"`
+	Priority    string              `json:"priority"`
+	RunAt       string              `json:"run_at"`
+	Delay       string              `json:"delay"`
 }
 
 type updateRequest struct {
@@ -84,56 +94,28 @@ type Data struct {
 	Meta map[string]interface{} `json:"meta"`
 }
 
-type Worker struct {
-	taskrAddr        string
-	projectID        string
-	topicName        string
-	subscriptionName string
-	client           *pubsubClient.Client
-	pubsub           *pubsub.Client
-	topic            *pubsub.Topic
-	subscription     *pubsub.Subscription
-	messages         chan *pubsub.Message
-}
-
-// SubscribeMessageHandler that handles the message
-type SubscribeMessageHandler func(chan *pubsub.Message)
-
-// ErrorHandler that logs the error received while reading a message
-type ErrorHandler func(error)
-
-// SubscriberConfig subscriber config
-type SubscriberConfig struct {
-	ProjectID        string
-	TopicName        string
-	SubscriptionName string
-	ErrorHandler     ErrorHandler
-	Handle           SubscribeMessageHandler
-}
-
-// Subscriber subscribe to a topic and pass each message to the
-// handler function
-type Subscriber struct {
-	topic        *pubsub.Topic
-	subscription *pubsub.Subscription
-	errorHandler ErrorHandler
-	handle       SubscribeMessageHandler
-	cancel       func()
-}
-
 type sampleMsg struct {
 	EventID string `json:"event_id"`
 }
 
-// NewServer creates a new server
+// NewSubscriber creates a new dispatcher reading job requests from the
+// configured intake source.
 func NewSubscriber(serverCfg Config) {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop receiving on SIGINT or SIGTERM, letting the executor's workers
+	// drain.
+	go func() {
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+		sig := <-signalChan
+		log.Printf("Received %s, shutting down", sig)
+		cancel()
+	}()
 
 	rand.Seed(time.Now().UnixNano())
 
-	if config.PubsubClient == nil {
-		log.Fatal("You must configure the Pub/Sub client in config.go before running pubsub_worker.")
-	}
 	// Setup redis queue.
 	redisPool = &redis.Pool{
 		MaxActive: 5,
@@ -144,282 +126,138 @@ func NewSubscriber(serverCfg Config) {
 		},
 	}
 
-	 downloadEnqueuer = work.NewEnqueuer("download", redisPool)
-	 transcodeEnqueuer = work.NewEnqueuer("transcode", redisPool)
-
-	//downloadEnqueuer = work.NewEnqueuer(serverCfg.Namespace, redisPool)
-	//transcodeEnqueuer = work.NewEnqueuer(serverCfg.Namespace, redisPool)
-
-	// Sets your Google Cloud Platform project ID.
-	projectID := "coresystem-171219"
-
-	subscriberConfig := SubscriberConfig{
-		ProjectID:        projectID,
-		TopicName:        config.PubsubTopicID,
-		SubscriptionName: config.PubsubTopicSubscription,
-		ErrorHandler: func(err error) {
-			log.Printf("Subscriber error: %v", err)
-		},
-		Handle: func(output chan *pubsub.Message) {
-			for {
-				pMsg := <-output
-				log.Printf("Message: %+v", string(pMsg.Data))
-				newMsg := &request{}
-				if err := json.Unmarshal(pMsg.Data, &newMsg); err != nil {
-					log.Errorf("failed to unmarshal message body", err)
-					return
-				}
-				go CreateJob(*newMsg)
-				log.Info("profile:", newMsg.Profile, "source", newMsg.Source, "dest:", newMsg.Destination)
-				pMsg.Ack()
-			}
-		},
+	exec, err := executor.New(redisPool)
+	if err != nil {
+		log.Fatalf("Error occured while creating the executor, Err: %v", err)
 	}
-	log.Printf("Subscriber config: %+v", subscriberConfig)
-	subscriber, err := CreateSubscription(ctx, subscriberConfig)
+	dispatcher = dispatch.New(redisPool, exec)
+	running := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(running)
+	}()
+	go dispatcher.RunSchedules(ctx)
+
+	log.Printf("Intake config: %+v", serverCfg.Intake)
+	source, err := intake.New(ctx, serverCfg.Intake, redisPool)
 	if err != nil {
-		log.Fatalf("Error occured while creating a subscriber, Err: %v", err)
+		log.Fatalf("Error occured while creating the intake source, Err: %v", err)
 	}
+	defer source.Close()
 
-	log.Printf("Subscriber: %+v", subscriber)
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go subscriber.Process(ctx, &wg)
-	wg.Wait()
+	err = source.Receive(ctx, handleMessage)
+	if err != nil && err != context.Canceled {
+		log.Printf("Subscriber error: %v", err)
+	}
 
+	cancel()
+	<-running
 }
 
-// CreateSubscription creates a subscription
-func CreateSubscription(ctx context.Context, subscriberConfig SubscriberConfig) (*Subscriber, error) {
-	projectID := "coresystem-171219"
-	client, err := getClient(ctx, projectID)
-	if err != nil {
-		return nil, err
+// handleMessage creates a job from an intake message.
+func handleMessage(ctx context.Context, msg intake.Message) {
+	log.Printf("Message: %+v", string(msg.Data()))
+	newMsg := &request{}
+	if err := json.Unmarshal(msg.Data(), &newMsg); err != nil {
+		// A malformed request will never succeed; drop it.
+		log.Errorf("failed to unmarshal message body: %v", err)
+		msg.Ack()
+		return
 	}
-	topic, err := client.createTopic(ctx, subscriberConfig.TopicName)
-	if err != nil {
-		return nil, err
+	if err := validate(*newMsg); err != nil {
+		log.Errorf("rejected request: %v", err)
+		msg.Ack()
+		return
 	}
-	subscription, err := client.createSubscription(ctx, subscriberConfig.SubscriptionName, topic)
-	if err != nil {
-		return nil, err
+
+	// Only ack once the job is durably recorded, so a failure here is
+	// redelivered; redeliveries resolve to the same job.
+	if _, err := CreateJob(*newMsg); err != nil {
+		log.Errorf("failed to create job %s: %v", newMsg.C24JobId, err)
+		msg.Nack()
+		return
 	}
-	return &Subscriber{
-		topic:        topic,
-		subscription: subscription,
-		errorHandler: subscriberConfig.ErrorHandler,
-		handle:       subscriberConfig.Handle,
-	}, nil
+	log.Info("profile:", newMsg.Profile, "source", newMsg.Source, "dest:", newMsg.Destination)
+	msg.Ack()
 }
 
-func CreateJob(r request) {
-	// Create Job and push the work to work queue.
-
-	job := models.Job{
-		GUID:        xid.New().String(),
-		C24JobID:    r.C24JobId,
-		Profile:     r.Profile,
-		Action:      r.Action,
-		Source:      r.Source,
-		Destination: r.Destination,
-		Status:      models.JobQueued, // Status queued.
+// validate checks a request can ever become a job. Invalid requests are
+// dropped rather than redelivered.
+func validate(r request) error {
+	switch r.Action {
+	case "download", "transcode", "snippetize":
+	default:
+		return fmt.Errorf("not a valid action type: %q", r.Action)
 	}
 
-	if r.Action == "download" {
-		// Send to work queue.
-		_, err := downloadEnqueuer.Enqueue("download", work.Q{
-			"guid":        job.GUID,
-			"profile":     job.Profile,
-			"source":      job.Source,
-			"destination": job.Destination,
-			"c24_job_id":  job.C24JobID,
-			"action":      job.Action,
-		})
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else if r.Action == "transcode" {
-		_, err := transcodeEnqueuer.Enqueue(r.C24JobId, work.Q{
-			"guid":        job.GUID,
-			"profile":     job.Profile,
-			"source":      job.Source,
-			"destination": job.Destination,
-			"c24_job_id":  job.C24JobID,
-			"action":      job.Action,
-		})
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else if r.Action == "snippetize" {
-
-	} else {
-		log.Fatal("Not a valid action type")
+	if r.Priority != "" && !models.IsValidPriority(r.Priority) {
+		return fmt.Errorf("not a valid priority: %q", r.Priority)
 	}
 
-	created := data.CreateJob(job)
+	if err := webhook.CheckCallback(r.Callback); err != nil {
+		return err
+	}
 
-	// Create the encode relationship.
-	ed := models.EncodeData{
-		JobID: created.ID,
-		Progress: models.NullFloat64{
-			NullFloat64: sql.NullFloat64{
-				Float64: 0,
-				Valid:   true,
-			},
-		},
-		Data: models.NullString{
-			NullString: sql.NullString{
-				String: "{}",
-				Valid:  true,
-			},
-		},
+	if _, err := helpers.ParseRunAt(r.RunAt, r.Delay); err != nil {
+		return err
 	}
-	edCreated := data.CreateEncodeData(ed)
-	created.EncodeDataID = edCreated.EncodeDataID
-	actions.PrepareEncodeJob(job)
-	log.Info(job)
-}
 
-// Process will start pulling from the pubsub. The process accepts a waitgroup as
-// it will be easier for us to orchestrate a use case where one application needs
-// more than one subscriber
-func (subscriber *Subscriber) Process(ctx context.Context, wg *sync.WaitGroup) {
-	log.Printf("Starting a Subscriber on topic %s", subscriber.topic.String())
-	output := make(chan *pubsub.Message)
-	go func(subscriber *Subscriber, output chan *pubsub.Message) {
-		defer close(output)
-
-		ctx, subscriber.cancel = context.WithCancel(ctx)
-		err := subscriber.subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
-			output <- msg
-		})
-
-		if err != nil {
-			// The wait group is stopped or marked done when an error is encountered
-			subscriber.errorHandler(err)
-			subscriber.stop()
-			wg.Done()
+	outputs := models.NewJobOutputs(r.Profile, r.Profiles, r.Outputs)
+	if len(outputs) == 0 {
+		return fmt.Errorf("job %s has no profiles", r.C24JobId)
+	}
+	for _, o := range outputs {
+		if _, err := config.GetFFmpegProfile(o.Profile); err != nil {
+			return fmt.Errorf("job %s has unknown profile %s", r.C24JobId, o.Profile)
 		}
-	}(subscriber, output)
-
-	subscriber.handle(output)
-}
-
-// Stop the subscriber, closing the channel that was returned by Start.
-func (subscriber *Subscriber) stop() {
-	if subscriber.cancel != nil {
-		log.Print("Stopped the subscriber")
-		subscriber.cancel()
 	}
+	return nil
 }
 
-type pubSubClient struct {
-	psclient *pubsub.Client
-}
-
-func getClient(ctx context.Context, projectID string) (*pubSubClient, error) {
-	client, err := pubsub.NewClient(ctx, projectID)
-	if err != nil {
-		log.Printf("Error when creating pubsub client. Err: %v", err)
-		return nil, err
+// CreateJob records the job for a request and pushes its work to the work
+// queue. A repeated request returns the job already recorded for it without
+// queueing it again.
+func CreateJob(r request) (*models.Job, error) {
+	if r.Metadata == nil {
+		r.Metadata = models.JobMetadata{}
 	}
-	return &pubSubClient{psclient: client}, nil
-}
-
-// topicExists checks if a given topic exists
-func (client *pubSubClient) topicExists(ctx context.Context, topicName string) (bool, error) {
-	topic := client.psclient.Topic(topicName)
-	return topic.Exists(ctx)
-}
 
-// createTopic creates a topic if a topic name does not exist or returns one
-// if it is already present
-func (client *pubSubClient) createTopic(ctx context.Context, topicName string) (*pubsub.Topic, error) {
-	topicExists, err := client.topicExists(ctx, topicName)
+	runAt, err := helpers.ParseRunAt(r.RunAt, r.Delay)
 	if err != nil {
-		log.Printf("Could not check if topic exists. Error: %+v", err)
 		return nil, err
 	}
-	var topic *pubsub.Topic
 
-	if !topicExists {
-		topic, err = client.psclient.CreateTopic(ctx, topicName)
-		if err != nil {
-			log.Printf("Could not create topic. Err: %+v", err)
-			return nil, err
-		}
-	} else {
-		topic = client.psclient.Topic(topicName)
+	outputs := models.NewJobOutputs(r.Profile, r.Profiles, r.Outputs)
+	if r.IdempotencyKey == "" {
+		r.IdempotencyKey = models.IdempotencyKey(r.C24JobId, r.Action, outputs)
 	}
 
-	return topic, nil
-}
-
-// createSubscription creates the subscription to a topic
-func (client *pubSubClient) createSubscription(ctx context.Context, subscriptionName string, topic *pubsub.Topic) (*pubsub.Subscription, error) {
-	subscription := client.psclient.Subscription(subscriptionName)
+	job := models.Job{
+		GUID:           xid.New().String(),
+		C24JobID:       r.C24JobId,
+		Profile:        outputs[0].Profile,
+		Action:         r.Action,
+		Meta:           r.Metadata,
+		Callback:       r.Callback,
+		Source:         r.Source,
+		Destination:    r.Destination,
+		IdempotencyKey: r.IdempotencyKey,
+		Tenant:         r.Tenant,
+		Priority:       r.Priority,
+		RunAt:          runAt,
+		Status:         models.JobQueued, // Status queued.
+	}
 
-	subscriptionExists, err := subscription.Exists(ctx)
+	created, isNew, err := data.SubmitJob(job, outputs)
 	if err != nil {
-		log.Printf("Could not check if subscription %s exists. Err: %v", subscriptionName, err)
 		return nil, err
 	}
-
-	if !subscriptionExists {
-
-		cfg := pubsub.SubscriptionConfig{
-			Topic: topic,
-			// The subscriber has a configurable, limited amount of time -- known as the ackDeadline -- to acknowledge
-			// the outstanding message. Once the deadline passes, the message is no longer considered outstanding, and
-			// Cloud Pub/Sub will attempt to redeliver the message.
-			AckDeadline: 60 * time.Second,
-		}
-
-		subscription, err = client.psclient.CreateSubscription(ctx, subscriptionName, cfg)
-		if err != nil {
-			log.Printf("Could not create subscription %s. Err: %v", subscriptionName, err)
-			return nil, err
-		}
-		subscription.ReceiveSettings = pubsub.ReceiveSettings{
-			// This is the maximum amount of messages that are allowed to be processed by the callback function at a time.
-			// Once this limit is reached, the client waits for messages to be acked or nacked by the callback before
-			// requesting more messages from the server.
-			MaxOutstandingMessages: 100,
-			// This is the maximum amount of time that the client will extend a message's deadline. This value should be
-			// set as high as messages are expected to be processed, plus some buffer.
-			MaxExtension: 10 * time.Second,
-		}
+	if !isNew {
+		log.Infof("job %s already submitted as %s", r.IdempotencyKey, created.GUID)
+		return created, nil
 	}
-	return subscription, nil
-}
 
-// subscriptionExists checks if a given subscription exists
-func (client *pubSubClient) subscriptionExists(ctx context.Context, subscriptionName string) (bool, error) {
-	subscription := client.psclient.Subscription(subscriptionName)
-	return subscription.Exists(ctx)
-}
-
-// deleteSubscription deletes a subscription
-func (client *pubSubClient) deleteSubscription(ctx context.Context, subscriptionName string) error {
-	return client.psclient.Subscription(subscriptionName).Delete(ctx)
-}
-
-// listAllSubscription lists all subscriptions in the project
-func (client *pubSubClient) listAllSubscription(ctx context.Context, topicName string) ([]string, error) {
-	subscriptionNames := make([]string, 0)
-	subscriptionIterator := client.psclient.Subscriptions(ctx)
-	for {
-		item, err := subscriptionIterator.Next()
-		if err == iterator.Done {
-			break
-		}
-
-		if err != nil {
-			log.Printf("Could not list all topics. Error %v", err)
-			return subscriptionNames, err
-		}
-		subscriptionNames = append(subscriptionNames, item.String())
-	}
-	return subscriptionNames, nil
+	// The job is recorded pending, the scheduler sends it to its work queue.
+	log.Info(created)
+	return created, nil
 }
@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	log "github.com/sirupsen/logrus"
 )
@@ -18,6 +19,11 @@ const (
 // FFmpeg struct.
 type FFmpeg struct {
 	Progress progress
+
+	// mu guards cmd and stopped, as Stop is called while Run runs.
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stopped bool
 }
 
 type progress struct {
@@ -34,8 +40,10 @@ type progress struct {
 	Progress   string
 }
 
-// Run runs the ffmpeg encoder with options.
-func (f *FFmpeg) Run(input string, output string, options []string) {
+// Run runs the ffmpeg encoder with options. It returns the error starting
+// ffmpeg or the error it exited with, an *exec.ExitError when it exited
+// non-zero.
+func (f *FFmpeg) Run(input string, output string, options []string) error {
 	args := []string{
 		"-hide_banner",
 		"-v", "0",
@@ -52,18 +60,32 @@ func (f *FFmpeg) Run(input string, output string, options []string) {
 	// Execute command.
 	log.Info("running FFmpeg with options: ", args)
 	cmd := exec.Command(ffmpegCmd, args...)
-	stdout, _ := cmd.StdoutPipe()
-	log.Info(stdout)
-	cmd.Start()
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Kill the encode right away when it was stopped while starting.
+	f.mu.Lock()
+	f.cmd = cmd
+	if f.stopped && cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+	f.mu.Unlock()
 
 	// Send progress updates.
+	f.Progress.quit = make(chan struct{})
 	go f.trackProgress()
 
 	// Update progress struct.
 	f.updateProgress(stdout)
 
-	cmd.Wait()
+	err = cmd.Wait()
 	f.finish()
+	return err
 }
 
 func (f *FFmpeg) updateProgress(stdout io.ReadCloser) {
@@ -118,7 +140,6 @@ func (f *FFmpeg) setProgressParts(parts []string) {
 }
 
 func (f *FFmpeg) trackProgress() {
-	f.Progress.quit = make(chan struct{})
 	ticker := time.NewTicker(updateInterval)
 
 	for {
@@ -134,4 +155,21 @@ func (f *FFmpeg) trackProgress() {
 
 func (f *FFmpeg) finish() {
 	close(f.Progress.quit)
-}
\ No newline at end of file
+}
+
+// Stop kills a running encode, or one about to start.
+func (f *FFmpeg) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	if f.cmd != nil && f.cmd.Process != nil {
+		f.cmd.Process.Kill()
+	}
+}
+
+// Stopped reports whether the encode was killed by Stop.
+func (f *FFmpeg) Stopped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopped
+}
@@ -0,0 +1,275 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	"github.com/harisbeha/media-transcoder/internal/data"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Request headers sent with every webhook.
+const (
+	HeaderEvent     = "X-Transcoder-Event"
+	HeaderDelivery  = "X-Transcoder-Delivery"
+	HeaderTimestamp = "X-Transcoder-Timestamp"
+	HeaderSignature = "X-Transcoder-Signature"
+)
+
+const (
+	defaultMaxAttempts  = 5
+	defaultBackoff      = 2 * time.Second
+	defaultTimeout      = 10 * time.Second
+	defaultPollInterval = time.Second
+	maxBackoff          = 5 * time.Minute
+
+	// claimBatch is how many due deliveries one poll attempts at once.
+	claimBatch = 20
+	// claimMargin pads a delivery's claim beyond its request timeout.
+	claimMargin = 30 * time.Second
+)
+
+// ErrNoSecret is returned for webhooks when no webhook_secret is configured
+// to sign them with.
+var ErrNoSecret = errors.New("webhook_secret must be set to send webhooks")
+
+// CheckCallback checks a job's callback can be honoured: its method is one
+// webhooks are sent with, and webhooks can be signed.
+func CheckCallback(c models.Callback) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.URL != "" && config.Get().WebhookSecret == "" {
+		return ErrNoSecret
+	}
+	return nil
+}
+
+// Payload is the body of a webhook.
+type Payload struct {
+	Event     string             `json:"event"`
+	Timestamp time.Time          `json:"timestamp"`
+	Job       *models.Job        `json:"job"`
+	Outputs   []models.JobOutput `json:"outputs"`
+	Progress  float64            `json:"progress,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// Notify records an event webhook for a job if the job asked for one, to
+// be sent by Run. The job is reloaded so the payload carries its current
+// status and outputs.
+func Notify(guid string, event string, progress float64, jobErr error) error {
+	job, err := data.GetJobByGUID(guid)
+	if err != nil {
+		return err
+	}
+	if job.Callback.URL == "" || !job.Callback.Wants(event) {
+		return nil
+	}
+
+	p := Payload{
+		Event:     event,
+		Timestamp: time.Now().UTC(),
+		Job:       job,
+		Outputs:   job.Outputs,
+		Progress:  progress,
+	}
+	if jobErr != nil {
+		p.Error = jobErr.Error()
+	}
+	if p.Outputs == nil {
+		p.Outputs = []models.JobOutput{}
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = data.CreateWebhookDelivery(models.WebhookDelivery{
+		JobID:   job.ID,
+		Event:   event,
+		URL:     job.Callback.URL,
+		Payload: body,
+		Status:  models.DeliveryPending,
+	})
+	return err
+}
+
+// Redeliver queues a previously recorded delivery to be sent again by Run,
+// with the callback headers stored on its job by then.
+func Redeliver(id int) (*models.WebhookDelivery, error) {
+	if err := data.RequeueWebhookDelivery(id); err != nil {
+		return nil, err
+	}
+	return data.GetWebhookDeliveryByID(id)
+}
+
+// Run sends pending deliveries until ctx is done, polling for due ones
+// every poll interval. Deliveries are claimed in the database, so several
+// processes may run it.
+func Run(ctx context.Context) {
+	if config.Get().WebhookSecret == "" {
+		log.Warn("webhook: no webhook_secret set, deliveries fail until one is")
+	}
+	interval := config.Get().WebhookPollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deliverDue()
+		}
+	}
+}
+
+// deliverDue attempts a batch of due deliveries at once.
+func deliverDue() {
+	// A claim outlasts an attempt, so no other process sends the delivery
+	// while it is in flight.
+	deliveries, err := data.ClaimWebhookDeliveries(claimBatch, timeout()+claimMargin)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range *deliveries {
+		wg.Add(1)
+		go func(d *models.WebhookDelivery) {
+			defer wg.Done()
+			attempt(d)
+		}(&(*deliveries)[i])
+	}
+	wg.Wait()
+}
+
+// attempt makes one attempt at a delivery and records its outcome.
+// Network errors and retryable responses leave it pending, to be attempted
+// again after an exponential backoff, until its attempts run out.
+func attempt(d *models.WebhookDelivery) {
+	var callback models.Callback
+	if job, err := data.GetJobByID(int(d.JobID)); err == nil {
+		callback = job.Callback
+	}
+
+	code, retry, err := send(d, callback)
+
+	d.Attempts++
+	d.ResponseCode = code
+	d.LastError = ""
+	if err != nil {
+		d.LastError = err.Error()
+	}
+
+	var wait time.Duration
+	switch {
+	case err == nil:
+		d.Status = models.DeliverySucceeded
+	case !retry || d.Attempts >= maxAttempts():
+		d.Status = models.DeliveryFailed
+	default:
+		wait = backoff(d.Attempts)
+		log.Infof("webhook: delivery %d failed, retrying in %s: %v", d.ID, wait, err)
+	}
+	if err := data.UpdateWebhookDelivery(*d, wait); err != nil {
+		log.Error(err)
+	}
+}
+
+// backoff returns how long to wait after a delivery's nth failed attempt.
+func backoff(attempts int) time.Duration {
+	base := config.Get().WebhookBackoff
+	if base <= 0 {
+		base = defaultBackoff
+	}
+	wait := base * time.Duration(1<<uint(attempts-1))
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+func maxAttempts() int {
+	if n := config.Get().WebhookMaxAttempts; n > 0 {
+		return n
+	}
+	return defaultMaxAttempts
+}
+
+func timeout() time.Duration {
+	if t := config.Get().WebhookTimeout; t > 0 {
+		return t
+	}
+	return defaultTimeout
+}
+
+// send makes a single delivery attempt with the callback's method and
+// headers. It returns the response code and whether a failure is worth
+// retrying.
+func send(d *models.WebhookDelivery, callback models.Callback) (int, bool, error) {
+	req, err := http.NewRequest(callback.HTTPMethod(), d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, false, err
+	}
+
+	// Webhooks are never sent unsigned.
+	secret := config.Get().WebhookSecret
+	if secret == "" {
+		return 0, false, ErrNoSecret
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	for k, v := range callback.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(secret, timestamp, d.Payload))
+
+	client := &http.Client{Timeout: timeout()}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return resp.StatusCode, retry, fmt.Errorf("webhook returned %s", resp.Status)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+// Receivers recompute it with the shared secret to verify a webhook.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
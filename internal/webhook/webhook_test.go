@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/harisbeha/media-transcoder/internal/config"
+	models "github.com/harisbeha/media-transcoder/internal/models"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("secret", "1570000000", []byte(`{"event":"job.completed"}`))
+	want := "f980cf3da171b073b202534bee2d0974a704c455370f8c6feb332038eee2deeb"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("other", "1570000000", []byte(`{"event":"job.completed"}`)) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("secret", "1570000001", []byte(`{"event":"job.completed"}`)) == want {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer func(d time.Duration) { config.C.WebhookBackoff = d }(config.C.WebhookBackoff)
+
+	tests := []struct {
+		base     time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{0, 1, defaultBackoff},
+		{0, 3, 4 * defaultBackoff},
+		{time.Second, 1, time.Second},
+		{time.Second, 2, 2 * time.Second},
+		{time.Second, 5, 16 * time.Second},
+		{time.Second, 10, maxBackoff},
+		{time.Second, 80, maxBackoff},
+	}
+	for _, tt := range tests {
+		config.C.WebhookBackoff = tt.base
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) with base %s = %s, want %s", tt.attempts, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestCheckCallback(t *testing.T) {
+	defer func(s string) { config.C.WebhookSecret = s }(config.C.WebhookSecret)
+
+	tests := []struct {
+		secret   string
+		callback models.Callback
+		wantErr  bool
+	}{
+		{"", models.Callback{}, false},
+		{"", models.Callback{Topic: "results"}, false},
+		{"", models.Callback{URL: "http://example.com/hook"}, true},
+		{"secret", models.Callback{URL: "http://example.com/hook"}, false},
+		{"secret", models.Callback{URL: "http://example.com/hook", Method: "put"}, false},
+		{"secret", models.Callback{URL: "http://example.com/hook", Method: "GET"}, true},
+	}
+	for _, tt := range tests {
+		config.C.WebhookSecret = tt.secret
+		if err := CheckCallback(tt.callback); (err != nil) != tt.wantErr {
+			t.Errorf("CheckCallback(%+v) with secret %q = %v, want error %v", tt.callback, tt.secret, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	defer func(s string) { config.C.WebhookSecret = s }(config.C.WebhookSecret)
+	config.C.WebhookSecret = "secret"
+
+	status := http.StatusOK
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	d := &models.WebhookDelivery{ID: 7, Event: "job.completed", URL: srv.URL, Payload: models.RawPayload(`{"event":"job.completed"}`)}
+	callback := models.Callback{URL: srv.URL, Method: "put", Headers: map[string]string{"Authorization": "Bearer token"}}
+
+	code, retry, err := send(d, callback)
+	if err != nil || code != http.StatusOK || retry {
+		t.Fatalf("send = %d, %v, %v, want 200 without error", code, retry, err)
+	}
+	if got.Method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", got.Method)
+	}
+	if h := got.Header.Get("Authorization"); h != "Bearer token" {
+		t.Errorf("Authorization = %q, want the callback's header", h)
+	}
+	if h := got.Header.Get(HeaderDelivery); h != "7" {
+		t.Errorf("%s = %q, want 7", HeaderDelivery, h)
+	}
+	want := "sha256=" + Sign("secret", got.Header.Get(HeaderTimestamp), body)
+	if h := got.Header.Get(HeaderSignature); h != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, h, want)
+	}
+
+	for _, tt := range []struct {
+		status int
+		retry  bool
+	}{
+		{http.StatusInternalServerError, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusBadRequest, false},
+		{http.StatusGone, false},
+	} {
+		status = tt.status
+		code, retry, err := send(d, callback)
+		if err == nil || code != tt.status || retry != tt.retry {
+			t.Errorf("send with %d = %d, %v, %v, want retry %v", tt.status, code, retry, err, tt.retry)
+		}
+	}
+
+	config.C.WebhookSecret = ""
+	if _, retry, err := send(d, callback); err != ErrNoSecret || retry {
+		t.Errorf("send without a secret = %v, %v, want ErrNoSecret", retry, err)
+	}
+}
@@ -10,7 +10,25 @@ create table jobs
   profile           varchar(128) not null,
   c24_job_id        varchar(128) not null,
   action            varchar(128) not null,
+  source            text not null default '',
+  destination       text not null default '',
   metadata JSONB,
+  callback JSONB,
+  idempotency_key   varchar(255) not null default '',
+  tenant            varchar(255) not null default '',
+  priority          varchar(16) not null default 'normal',
+  dispatch_stage    varchar(32) not null default '',
+  dispatched_date   timestamp,
+  run_at            timestamp,
+  batch_id          integer,
+  pod_name          varchar(255) not null default '',
+  lease_id          varchar(32),
+  lease_owner       varchar(255) not null default '',
+  lease_stage       varchar(32) not null default '',
+  lease_progress    double precision not null default 0,
+  lease_expires     timestamp,
+  heartbeat_date    timestamp,
+  reaped_count      integer not null default 0,
   created_date timestamp default CURRENT_TIMESTAMP,
   status       varchar(64)
 );
@@ -27,6 +45,39 @@ create unique index jobs_guid_uindex
 create index jobs_status_index
   on jobs (status);
 
+create unique index jobs_idempotency_key_uindex
+  on jobs (idempotency_key)
+  where idempotency_key <> '';
+
+create index jobs_status_created_date_index
+  on jobs (status, created_date);
+
+create index jobs_created_date_index
+  on jobs (created_date);
+
+create index jobs_profile_index
+  on jobs (profile);
+
+create index jobs_action_index
+  on jobs (action);
+
+create index jobs_c24_job_id_index
+  on jobs (c24_job_id);
+
+create index jobs_tenant_index
+  on jobs (tenant);
+
+create index jobs_pending_index
+  on jobs (tenant, created_date)
+  where dispatched_date is null;
+
+create index jobs_lease_expires_index
+  on jobs (lease_expires)
+  where lease_id is not null;
+
+create index jobs_metadata_index
+  on jobs using gin (metadata jsonb_path_ops);
+
 -- auto-generated definition
 create table transcode
 (
@@ -46,3 +97,126 @@ alter table transcode
 create unique index transcode_id_uindex
   on transcode (id);
 
+
+create table job_events
+(
+  id           serial not null
+    constraint job_events_pkey
+    primary key,
+  job_id       integer not null
+    constraint job_events_jobs_id_fk
+    references jobs (id) on delete cascade,
+  status       varchar(64) not null,
+  worker       varchar(255),
+  message      text,
+  created_date timestamp default CURRENT_TIMESTAMP
+);
+
+alter table job_events
+  owner to postgres;
+
+create index job_events_job_id_created_date_index
+  on job_events (job_id, created_date);
+
+create table job_outputs
+(
+  id           serial not null
+    constraint job_outputs_pkey
+    primary key,
+  job_id       integer not null
+    constraint job_outputs_jobs_id_fk
+    references jobs (id) on delete cascade,
+  profile      varchar(128) not null,
+  url          text not null default '',
+  size         bigint not null default 0,
+  duration     double precision not null default 0,
+  bitrate      bigint not null default 0,
+  checksum     varchar(128) not null default '',
+  status       varchar(64) not null,
+  created_date timestamp default CURRENT_TIMESTAMP
+);
+
+alter table job_outputs
+  owner to postgres;
+
+create index job_outputs_job_id_index
+  on job_outputs (job_id);
+
+create index job_outputs_profile_index
+  on job_outputs (profile);
+
+create table webhook_deliveries
+(
+  id            serial not null
+    constraint webhook_deliveries_pkey
+    primary key,
+  job_id        integer not null
+    constraint webhook_deliveries_jobs_id_fk
+    references jobs (id) on delete cascade,
+  event         varchar(64) not null,
+  url           text not null,
+  payload       jsonb not null,
+  status        varchar(64) not null,
+  attempts      integer not null default 0,
+  response_code integer not null default 0,
+  last_error    text not null default '',
+  next_attempt  timestamp default CURRENT_TIMESTAMP,
+  created_date  timestamp default CURRENT_TIMESTAMP,
+  updated_date  timestamp default CURRENT_TIMESTAMP
+);
+
+alter table webhook_deliveries
+  owner to postgres;
+
+create index webhook_deliveries_job_id_index
+  on webhook_deliveries (job_id);
+
+create index webhook_deliveries_next_attempt_index
+  on webhook_deliveries (next_attempt)
+  where status = 'pending';
+
+create table dead_letters
+(
+  id            serial not null
+    constraint dead_letters_pkey
+    primary key,
+  job_id        integer not null
+    constraint dead_letters_jobs_id_fk
+    references jobs (id) on delete cascade,
+  stage         varchar(64) not null,
+  error         text not null default '',
+  attempts      integer not null default 0,
+  created_date  timestamp default CURRENT_TIMESTAMP,
+  replayed_date timestamp
+);
+
+alter table dead_letters
+  owner to postgres;
+
+create index dead_letters_replayed_date_index
+  on dead_letters (replayed_date);
+
+
+create table batches
+(
+  id           serial not null
+    constraint batches_pkey
+    primary key,
+  guid         varchar(128) not null,
+  name         varchar(255) not null default '',
+  tenant       varchar(255) not null default '',
+  created_date timestamp default CURRENT_TIMESTAMP
+);
+
+alter table batches
+  owner to postgres;
+
+create unique index batches_guid_uindex
+  on batches (guid);
+
+alter table jobs
+  add constraint jobs_batches_id_fk
+  foreign key (batch_id) references batches (id) on delete set null;
+
+create index jobs_batch_id_index
+  on jobs (batch_id);